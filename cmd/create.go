@@ -8,39 +8,106 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"chain4travel.com/camktncr/pkg"
 	"chain4travel.com/camktncr/pkg/version1"
 	"chain4travel.com/camktncr/pkg/version1/k8s"
+	"github.com/ava-labs/avalanchego/genesis"
 	"github.com/spf13/cobra"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 )
 
 func init() {
 	createCmd.Flags().Uint64("api-nodes", 2, "number of api-nodes")
 	createCmd.Flags().Uint64("validators", 5, "number of validators to create (cannot be higher than the initial generated number)")
+	createCmd.Flags().Uint64("archive-nodes", 0, "number of archive nodes, api-nodes that keep the full history of the C-chain")
 	createCmd.Flags().String("validator-ram", "1Gi", "ram of the validators")
 	createCmd.Flags().String("validator-cpu", "500m", "cpu of the validators")
 	createCmd.Flags().String("api-nodes-ram", "1Gi", "ram of the api-nodes")
 	createCmd.Flags().String("api-nodes-cpu", "500m", "cpu of the api-nodes")
+	createCmd.Flags().String("archive-nodes-ram", "2Gi", "ram of the archive-nodes")
+	createCmd.Flags().String("archive-nodes-cpu", "1", "cpu of the archive-nodes")
+	createCmd.Flags().String("validator-storage", "10Gi", "size of the data volume of the validators")
+	createCmd.Flags().String("validator-storage-class", "", "storage class of the validator data volumes (empty uses the cluster default)")
+	createCmd.Flags().String("validator-access-mode", string(v1.ReadWriteOnce), "access mode of the validator data volumes")
+	createCmd.Flags().String("api-nodes-storage", "10Gi", "size of the data volume of the api-nodes")
+	createCmd.Flags().String("api-nodes-storage-class", "", "storage class of the api-node data volumes (empty uses the cluster default)")
+	createCmd.Flags().String("api-nodes-access-mode", string(v1.ReadWriteOnce), "access mode of the api-node data volumes")
+	createCmd.Flags().String("archive-nodes-storage", "100Gi", "size of the data volume of the archive-nodes")
+	createCmd.Flags().String("archive-nodes-storage-class", "", "storage class of the archive-node data volumes (empty uses the cluster default)")
+	createCmd.Flags().String("archive-nodes-access-mode", string(v1.ReadWriteOnce), "access mode of the archive-node data volumes")
+	createCmd.Flags().Bool("ephemeral-storage", false, "keep node data in emptyDir volumes instead of persistent volumes, data is lost when a pod restarts")
+	addSchedulingFlags(createCmd, "validator", version1.SPREAD_PREFERRED)
+	addSchedulingFlags(createCmd, "api-nodes", version1.SPREAD_NONE)
+	addSchedulingFlags(createCmd, "archive-nodes", version1.SPREAD_NONE)
+	createCmd.Flags().String("scheduling-file", "", "yaml or json file with limits, node selectors, tolerations, affinity and spread per role (flags take precedence)")
+	createCmd.Flags().Duration("validator-startup-timeout", 30*time.Minute, "time a validator gets to bootstrap before it is restarted")
+	createCmd.Flags().Duration("api-nodes-startup-timeout", 60*time.Minute, "time an api-node gets to bootstrap before it is restarted")
+	createCmd.Flags().Duration("archive-nodes-startup-timeout", 120*time.Minute, "time an archive-node gets to bootstrap before it is restarted")
+	createCmd.Flags().Duration("validator-liveness-timeout", 2*time.Minute, "time a validator may stop answering before it is restarted")
+	createCmd.Flags().Duration("api-nodes-liveness-timeout", 2*time.Minute, "time an api-node may stop answering before it is restarted")
+	createCmd.Flags().Duration("archive-nodes-liveness-timeout", 2*time.Minute, "time an archive-node may stop answering before it is restarted")
+	createCmd.Flags().StringArray("node-flag", nil, "camino-node flag of all nodes as <flag>=<value> without the leading --, e.g. log-level=info")
+	createCmd.Flags().StringArray("validator-node-flag", nil, "camino-node flag of the root node and validators, replaces --node-flag")
+	createCmd.Flags().StringArray("api-nodes-node-flag", nil, "camino-node flag of the api-nodes, replaces --node-flag")
+	createCmd.Flags().StringArray("archive-nodes-node-flag", nil, "camino-node flag of the archive-nodes, replaces --node-flag")
+	createCmd.Flags().StringArray("chain-config", nil, "chain config of all nodes as <chain>=<json file>, e.g. C=c-chain.json")
+	createCmd.Flags().StringArray("validator-chain-config", nil, "chain config of the root node and validators, replaces --chain-config")
+	createCmd.Flags().StringArray("api-nodes-chain-config", nil, "chain config of the api-nodes, replaces --chain-config")
+	createCmd.Flags().StringArray("archive-nodes-chain-config", nil, "chain config of the archive-nodes, a C-chain config replaces the one without pruning")
+	createCmd.Flags().Uint64("archive-nodes-tx-lookup-limit", 0, "number of recent blocks the archive-nodes index transactions of (0 indexes all blocks)")
+	createCmd.Flags().Bool("archive-ingress", false, "publish the archive-nodes under /archive")
+	createCmd.Flags().Bool("disable-probes", false, "do not add startup, readiness and liveness probes to the nodes")
+	createCmd.Flags().Bool("disable-network-policies", false, "do not isolate the network with network policies (for clusters without a policy enforcing cni)")
+	createCmd.Flags().StringSlice("ingress-namespaces", []string{"ingress-nginx"}, "namespaces of the ingress controller that may access the http api")
+	createCmd.Flags().StringSlice("monitoring-namespaces", []string{"monitoring"}, "namespaces of prometheus that may access the http api")
+	createCmd.Flags().StringSlice("network-policy-allow", nil, "additional CIDRs or namespaces that may access the http api")
 	createCmd.Flags().String("tls-secret-name", "kopernikus.camino.foundation-ingress-tls", "tls secret located in default namespace")
 	createCmd.Flags().String("pull-secret-name", "gcr-image-pull", "pull secret located in default namespace")
 	createCmd.Flags().String("image", "europe-west3-docker.pkg.dev/pwk-c4t-dev/internal-camino-dev/camino-node:tiedemann-64de0a0003bfab988da62850eef37ef01f82fdad-1668765791", "docker image to run the nodes")
+	createCmd.Flags().StringSlice("image-override", nil, "run nodes with another image as <role>[:<from>[-<to>]]=<image>, e.g. validator:3-4=<image> (the image of a role may change only once between its ordinals)")
 	createCmd.Flags().String("domain", "camino.network", "under which domain to publish the network api nodes")
 	createCmd.Flags().DurationP("timeout", "t", 0, "stop execution after this time (non negative and 0 means no timeout)")
 	createCmd.Flags().Bool("enable-monitoring", true, "toggle the creation of service monitors")
+	createCmd.Flags().Bool("enable-dashboards", false, "provision grafana dashboards of the network as config maps for the grafana sidecar")
+	createCmd.Flags().String("dashboard-label", k8s.DEFAULT_DASHBOARD_LABEL, "key=value label the grafana sidecar discovers dashboards with")
+	createCmd.Flags().Bool("enable-alerts", false, "provision prometheus alert rules of the network")
+	createCmd.Flags().Bool("node-routes", false, "create a service per node and publish it under /node/<type>-<ordinal>/ and /node/<NodeID>/")
+	createCmd.Flags().Bool("node-routes-admin", false, "also publish the admin api of single nodes when --node-routes is set")
+	createCmd.Flags().String("p2p-exposure", version1.P2P_EXPOSURE_NONE, "expose the staking port of every validator so nodes outside of the cluster can join (none|loadbalancer|nodeport)")
+	createCmd.Flags().String("p2p-public-ip", "", "address announced by validators in nodeport mode (defaults to the ip of the k8s node the pod runs on)")
+	createCmd.Flags().Int32("p2p-node-port-base", 30651, "first node port used in nodeport mode, validator n listens on base+n")
+	createCmd.Flags().Bool("reuse-genesis", false, "start with the genesis already stored in the cluster, e.g. after 'k8s restore'")
+	createCmd.Flags().Bool("store-network", false, "store the encrypted network file and k8s configuration in the cluster so others can 'k8s pull' it")
+	createCmd.Flags().String("passphrase", "", fmt.Sprintf("passphrase to encrypt the stored network with (defaults to $%s)", PASSPHRASE_ENV))
+	addSecretProviderFlags(createCmd)
+	createCmd.Flags().Bool("resume", false, "continue a failed create with the step that failed")
+	createCmd.Flags().StringSlice("only", nil, "only run these steps ("+strings.Join(k8s.StepNames(createSteps(&createRun{})), ", ")+")")
+	createCmd.Flags().StringSlice("skip", nil, "do not run these steps")
+	createCmd.Flags().Bool("force", false, "create the network even if the namespace exists and is not owned by camktncr")
 	createCmd.Flags().BoolP("ignore-version-check", "c", false, "toggle the creation of service monitors")
 }
 
+const VAULT_ADDR_ENV = "VAULT_ADDR"
+const VAULT_TOKEN_ENV = "VAULT_TOKEN"
+
 var createCmd = &cobra.Command{
 	Use:   "create <network-name>",
 	Short: "creates the k8s configuration and lauches the network",
 	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 
+		start := time.Now()
 		networkName := args[0]
 
 		kubeconfig, err := cmd.Flags().GetString("kubeconfig")
@@ -53,6 +120,11 @@ var createCmd = &cobra.Command{
 			return err
 		}
 
+		imageOverrides, err := imageOverridesFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+
 		domain, err := cmd.Flags().GetString("domain")
 		if err != nil {
 			return err
@@ -74,6 +146,107 @@ var createCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
+		archiveCpu, err := cmd.Flags().GetString("archive-nodes-cpu")
+		if err != nil {
+			return err
+		}
+		archiveRam, err := cmd.Flags().GetString("archive-nodes-ram")
+		if err != nil {
+			return err
+		}
+
+		validatorStorage, err := storageFromFlags(cmd, "validator")
+		if err != nil {
+			return err
+		}
+		apiStorage, err := storageFromFlags(cmd, "api-nodes")
+		if err != nil {
+			return err
+		}
+		archiveStorage, err := storageFromFlags(cmd, "archive-nodes")
+		if err != nil {
+			return err
+		}
+		ephemeralStorage, err := cmd.Flags().GetBool("ephemeral-storage")
+		if err != nil {
+			return err
+		}
+
+		schedulingFile, err := cmd.Flags().GetString("scheduling-file")
+		if err != nil {
+			return err
+		}
+		schedulingSpec, err := loadSchedulingSpec(schedulingFile)
+		if err != nil {
+			return err
+		}
+		validatorLimits, validatorScheduling, err := schedulingFromFlags(cmd, "validator", schedulingSpec.Validator)
+		if err != nil {
+			return err
+		}
+		apiLimits, apiScheduling, err := schedulingFromFlags(cmd, "api-nodes", schedulingSpec.Api)
+		if err != nil {
+			return err
+		}
+		archiveLimits, archiveScheduling, err := schedulingFromFlags(cmd, "archive-nodes", schedulingSpec.Archive)
+		if err != nil {
+			return err
+		}
+
+		validatorProbe, err := probeFromFlags(cmd, "validator")
+		if err != nil {
+			return err
+		}
+		apiProbe, err := probeFromFlags(cmd, "api-nodes")
+		if err != nil {
+			return err
+		}
+		archiveProbe, err := probeFromFlags(cmd, "archive-nodes")
+		if err != nil {
+			return err
+		}
+		validatorNodeConfig, err := nodeConfigFromFlags(cmd, "validator")
+		if err != nil {
+			return err
+		}
+		apiNodeConfig, err := nodeConfigFromFlags(cmd, "api-nodes")
+		if err != nil {
+			return err
+		}
+		archiveNodeConfig, err := nodeConfigFromFlags(cmd, "archive-nodes")
+		if err != nil {
+			return err
+		}
+		archiveTxLookupLimit, err := cmd.Flags().GetUint64("archive-nodes-tx-lookup-limit")
+		if err != nil {
+			return err
+		}
+		archiveIngress, err := cmd.Flags().GetBool("archive-ingress")
+		if err != nil {
+			return err
+		}
+
+		disableProbes, err := cmd.Flags().GetBool("disable-probes")
+		if err != nil {
+			return err
+		}
+
+		disableNetworkPolicies, err := cmd.Flags().GetBool("disable-network-policies")
+		if err != nil {
+			return err
+		}
+		ingressNamespaces, err := cmd.Flags().GetStringSlice("ingress-namespaces")
+		if err != nil {
+			return err
+		}
+		monitoringNamespaces, err := cmd.Flags().GetStringSlice("monitoring-namespaces")
+		if err != nil {
+			return err
+		}
+		networkPolicyAllow, err := cmd.Flags().GetStringSlice("network-policy-allow")
+		if err != nil {
+			return err
+		}
 
 		tlsSecretName, err := cmd.Flags().GetString("tls-secret-name")
 		if err != nil {
@@ -90,6 +263,56 @@ var createCmd = &cobra.Command{
 			return err
 		}
 
+		enableDashboards, err := cmd.Flags().GetBool("enable-dashboards")
+		if err != nil {
+			return err
+		}
+
+		dashboardLabel, err := cmd.Flags().GetString("dashboard-label")
+		if err != nil {
+			return err
+		}
+
+		enableAlerts, err := cmd.Flags().GetBool("enable-alerts")
+		if err != nil {
+			return err
+		}
+
+		nodeRoutes, err := cmd.Flags().GetBool("node-routes")
+		if err != nil {
+			return err
+		}
+
+		nodeRoutesAdmin, err := cmd.Flags().GetBool("node-routes-admin")
+		if err != nil {
+			return err
+		}
+
+		p2pExposure, err := cmd.Flags().GetString("p2p-exposure")
+		if err != nil {
+			return err
+		}
+		switch p2pExposure {
+		case version1.P2P_EXPOSURE_NONE, version1.P2P_EXPOSURE_LOADBALANCER, version1.P2P_EXPOSURE_NODEPORT:
+		default:
+			return fmt.Errorf("unknown p2p exposure mode '%s'", p2pExposure)
+		}
+
+		p2pPublicIP, err := cmd.Flags().GetString("p2p-public-ip")
+		if err != nil {
+			return err
+		}
+
+		p2pNodePortBase, err := cmd.Flags().GetInt32("p2p-node-port-base")
+		if err != nil {
+			return err
+		}
+
+		stakerSecrets, err := stakerSecretsFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+
 		k8sConfig := version1.K8sConfig{
 			K8sPrefix: networkName,
 			Namespace: networkName,
@@ -97,6 +320,7 @@ var createCmd = &cobra.Command{
 				"network": networkName,
 			},
 			Image:          image,
+			ImageOverrides: imageOverrides,
 			Domain:         domain,
 			TLSSecretName:  tlsSecretName,
 			PullSecretName: pullSecretName,
@@ -109,8 +333,53 @@ var createCmd = &cobra.Command{
 					v1.ResourceCPU:    resource.MustParse(validatorCpu),
 					v1.ResourceMemory: resource.MustParse(validatorRam),
 				},
+				Archive: v1.ResourceList{
+					v1.ResourceCPU:    resource.MustParse(archiveCpu),
+					v1.ResourceMemory: resource.MustParse(archiveRam),
+				},
+				ApiLimits:           apiLimits,
+				ValidatorLimits:     validatorLimits,
+				ArchiveLimits:       archiveLimits,
+				ApiScheduling:       apiScheduling,
+				ValidatorScheduling: validatorScheduling,
+				ArchiveScheduling:   archiveScheduling,
+			},
+			Storage: version1.K8sStorages{
+				Api:       apiStorage,
+				Validator: validatorStorage,
+				Archive:   archiveStorage,
+				Ephemeral: ephemeralStorage,
+			},
+			Probes: version1.K8sProbes{
+				Api:       apiProbe,
+				Validator: validatorProbe,
+				Archive:   archiveProbe,
+				Disabled:  disableProbes,
+			},
+			NodeConfigs: version1.K8sNodeConfigs{
+				Api:       apiNodeConfig,
+				Validator: validatorNodeConfig,
+				Archive:   archiveNodeConfig,
+			},
+			NetworkPolicies: version1.K8sNetworkPolicies{
+				Enabled:              !disableNetworkPolicies,
+				IngressNamespaces:    ingressNamespaces,
+				MonitoringNamespaces: monitoringNamespaces,
+				Allow:                networkPolicyAllow,
 			},
 			EnableMonitoring: enableMonitoring,
+			EnableDashboards: enableDashboards,
+			DashboardLabel:   dashboardLabel,
+			EnableAlerts:     enableAlerts,
+			NodeRoutes:       nodeRoutes,
+			NodeRoutesAdmin:  nodeRoutesAdmin,
+			P2PExposure:      p2pExposure,
+			P2PPublicIP:      p2pPublicIP,
+			P2PNodePortBase:  p2pNodePortBase,
+
+			ArchiveIngress:       archiveIngress,
+			ArchiveTxLookupLimit: archiveTxLookupLimit,
+			StakerSecrets:        stakerSecrets,
 		}
 
 		numValidators, err := cmd.Flags().GetUint64("validators")
@@ -123,13 +392,23 @@ var createCmd = &cobra.Command{
 			return err
 		}
 
+		numArchiveNodes, err := cmd.Flags().GetUint64("archive-nodes")
+		if err != nil {
+			return err
+		}
+		if k8sConfig.ArchiveIngress && numArchiveNodes == 0 {
+			return fmt.Errorf("--archive-ingress needs at least one archive node")
+		}
+
 		timeoutDur, err := cmd.Flags().GetDuration("timeout")
 		if err != nil {
 			return err
 		}
 		ctx := cmd.Context()
 		if timeoutDur > 0 {
-			ctx, _ = context.WithTimeout(ctx, timeoutDur)
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeoutDur)
+			defer cancel()
 		}
 
 		kRest, k, err := pkg.InitClientSet(kubeconfig)
@@ -137,6 +416,27 @@ var createCmd = &cobra.Command{
 			return err
 		}
 
+		caps, err := k8s.DiscoverCapabilities(kRest)
+		if err != nil {
+			return err
+		}
+		if k8sConfig.EnableMonitoring && !caps.ServiceMonitors {
+			log.Println("prometheus operator crds not found, falling back to prometheus.io/scrape pod annotations")
+			k8sConfig.ScrapeAnnotations = true
+		}
+		if k8sConfig.EnableAlerts && !caps.PrometheusRules {
+			log.Println("prometheus operator crds not found, skipping alert rules")
+			k8sConfig.EnableAlerts = false
+		}
+		if k8sConfig.StakerSecrets.ExternalSecretStore != "" && !caps.ExternalSecrets {
+			return fmt.Errorf("external secrets operator crds not found, cannot sync the staker secrets from store '%s'", k8sConfig.StakerSecrets.ExternalSecretStore)
+		}
+
+		secretProvider, err := secretProviderFromFlags(cmd, k, k8sConfig)
+		if err != nil {
+			return err
+		}
+
 		network, err := version1.LoadNetwork(fmt.Sprintf("%s.json", networkName))
 		if err != nil {
 			return err
@@ -159,6 +459,11 @@ var createCmd = &cobra.Command{
 
 		}
 
+		if network.GenesisConfig.NetworkID == 0 {
+			return fmt.Errorf("network json has no network id, please regenerate")
+		}
+		k8sConfig.NetworkID = network.GenesisConfig.NetworkID
+
 		numInitialStakers := len(network.GenesisConfig.InitialStakers)
 
 		if int(numValidators) < numInitialStakers {
@@ -169,72 +474,528 @@ var createCmd = &cobra.Command{
 			return fmt.Errorf("network config '%s' does not contain enough validators: %d > %d", networkName, numValidators, len(network.Stakers))
 		}
 
-		err = k8s.CreateNamespace(cmd.Context(), k, k8sConfig)
+		force, err := cmd.Flags().GetBool("force")
 		if err != nil {
 			return err
 		}
 
-		err = k8s.CopySecretFromDefaultNamespace(ctx, k, k8sConfig, pullSecretName)
+		storeNetwork, err := cmd.Flags().GetBool("store-network")
 		if err != nil {
 			return err
 		}
-		err = k8s.CopySecretFromDefaultNamespace(ctx, k, k8sConfig, tlsSecretName)
-		if err != nil {
-			return err
+		if storeNetwork && k8sConfig.StakerSecrets.ExcludePrivateKeys {
+			return fmt.Errorf("--store-network stores the private keys in the cluster and cannot be combined with --exclude-private-keys")
 		}
-		err = k8s.CreateRBAC(ctx, k, k8sConfig)
-		if err != nil {
-			return err
+		var passphrase string
+		if storeNetwork {
+			passphrase, err = passphraseFromFlags(cmd)
+			if err != nil {
+				return err
+			}
 		}
 
-		now := time.Now().Unix()
-		genesisConfig := version1.BuildGenesisConfig(network.GenesisConfig.Allocations, uint64(now), network.Stakers[:numValidators], networkName, uint64(network.GenesisConfig.NetworkID))
-
-		// err = k8s.CreateNetworkConfigMap(ctx, k, network.GenesisConfig, k8sConfig)
-		err = k8s.CreateNetworkConfigMap(ctx, k, genesisConfig, k8sConfig)
+		reuseGenesis, err := cmd.Flags().GetBool("reuse-genesis")
 		if err != nil {
 			return err
 		}
 
-		err = k8s.CreateScriptsConfigMap(ctx, k, k8sConfig)
+		pipelineOptions, err := pipelineFromFlags(cmd)
 		if err != nil {
 			return err
 		}
 
-		err = k8s.CreateStakerSecrets(ctx, k, network.Stakers, k8sConfig)
+		err = k8s.CreateNamespace(ctx, k, k8sConfig, force)
 		if err != nil {
 			return err
 		}
 
-		err = k8s.CreateRootNode(ctx, kRest, k, k8sConfig)
+		ctx, unlock, err := lockNetwork(ctx, k, k8sConfig, "create")
 		if err != nil {
 			return err
 		}
+		defer unlock()
+
+		run := &createRun{
+			k8sConfig:         k8sConfig,
+			kRest:             kRest,
+			k:                 k,
+			network:           network,
+			networkName:       networkName,
+			storeNetwork:      storeNetwork,
+			passphrase:        passphrase,
+			reuseGenesis:      reuseGenesis,
+			pullSecretName:    pullSecretName,
+			tlsSecretName:     tlsSecretName,
+			secretProvider:    secretProvider,
+			numValidators:     numValidators,
+			numInitialStakers: numInitialStakers,
+			numApiNodes:       numApiNodes,
+			numArchiveNodes:   numArchiveNodes,
+			nodeRoutes:        nodeRoutes,
+			ingAnnotations: map[string]string{
+				"cert-manager.io/cluster-issuer": "prod-letsencrypt",
+			},
+		}
 
-		err = k8s.CreateValidators(ctx, kRest, k, k8sConfig, int32(numValidators)-1)
+		stepResults, err := k8s.RunPipeline(ctx, k, k8sConfig, "create", createSteps(run), pipelineOptions)
 		if err != nil {
 			return err
 		}
 
-		err = k8s.CreateApiNodes(ctx, kRest, k, k8sConfig, int32(numApiNodes))
+		resources := []string{
+			"statefulset/" + k8sConfig.PrefixWith("root"),
+			"statefulset/" + k8sConfig.PrefixWith("validator-*"),
+			"statefulset/" + k8sConfig.PrefixWith("api"),
+			"ingress/" + k8sConfig.PrefixWith("ingress"),
+			"ingress/" + k8sConfig.PrefixWith("ingress-static"),
+		}
+		if numArchiveNodes > 0 {
+			resources = append(resources, "statefulset/"+k8sConfig.PrefixWith("archive"))
+		}
+		if nodeRoutes {
+			resources = append(resources, "ingress/"+k8sConfig.PrefixWith("ingress-nodes"))
+		}
+		if k8sConfig.EnableDashboards {
+			resources = append(resources, "configmap/"+k8sConfig.PrefixWith("dashboard-*"))
+		}
+		if k8sConfig.EnableAlerts {
+			resources = append(resources, "prometheusrule/"+k8sConfig.PrefixWith("alerts"))
+		}
+
+		nodes, err := k8s.ListNodes(ctx, k, k8sConfig)
 		if err != nil {
 			return err
 		}
 
-		ingAnnotations := map[string]string{
-			"cert-manager.io/cluster-issuer": "prod-letsencrypt",
+		result := createResult{
+			Network:   networkName,
+			Namespace: k8sConfig.Namespace,
+			Resources: resources,
+			Endpoints: map[string]string{
+				"api":    k8s.IngressURL(k8sConfig, "/"),
+				"static": k8s.IngressURL(k8sConfig, "/static"),
+			},
+			Nodes:      nodes,
+			Registered: run.registered,
+			Steps:      stepResults,
+		}
+		if k8sConfig.ArchiveIngress {
+			result.Endpoints["archive"] = k8s.IngressURL(k8sConfig, "/archive")
+		}
+
+		if k8sConfig.ExposesP2P() {
+			ids, ips, err := k8s.P2PBootstrapPeers(ctx, k, k8sConfig, network.Stakers[:numValidators])
+			if err != nil {
+				return err
+			}
+
+			// the genesis step was skipped when resuming
+			genesisConfig := run.genesisConfig
+			if genesisConfig == nil {
+				genesisConfig, err = k8s.GetNetworkGenesis(ctx, k, k8sConfig)
+				if err != nil {
+					return err
+				}
+			}
+
+			genesisPath := fmt.Sprintf("%s-genesis.json", networkName)
+			genesisJson, err := json.Marshal(genesisConfig)
+			if err != nil {
+				return err
+			}
+			err = os.WriteFile(genesisPath, genesisJson, 0644)
+			if err != nil {
+				return err
+			}
+
+			result.Bootstrap = &bootstrapResult{
+				NetworkID: genesisConfig.NetworkID,
+				IDs:       ids,
+				IPs:       ips,
+				Genesis:   genesisPath,
+			}
+		}
+
+		result.Duration = duration(time.Since(start))
+		return printResult(cmd, result)
+	},
+}
+
+func pipelineFromFlags(cmd *cobra.Command) (k8s.PipelineOptions, error) {
+	resume, err := cmd.Flags().GetBool("resume")
+	if err != nil {
+		return k8s.PipelineOptions{}, err
+	}
+	only, err := cmd.Flags().GetStringSlice("only")
+	if err != nil {
+		return k8s.PipelineOptions{}, err
+	}
+	skip, err := cmd.Flags().GetStringSlice("skip")
+	if err != nil {
+		return k8s.PipelineOptions{}, err
+	}
+	if resume && len(only) > 0 {
+		return k8s.PipelineOptions{}, fmt.Errorf("--resume and --only cannot be combined")
+	}
+	return k8s.PipelineOptions{Resume: resume, Only: only, Skip: skip}, nil
+}
+
+func imageOverridesFromFlags(cmd *cobra.Command) ([]version1.K8sImageOverride, error) {
+	values, err := cmd.Flags().GetStringSlice("image-override")
+	if err != nil {
+		return nil, err
+	}
+
+	overrides := make([]version1.K8sImageOverride, 0, len(values))
+	for _, value := range values {
+		nodes, image, ok := strings.Cut(value, "=")
+		if !ok || image == "" {
+			return nil, fmt.Errorf("invalid image override '%s', expected <role>[:<from>[-<to>]]=<image>", value)
+		}
+
+		override := version1.K8sImageOverride{From: 0, To: -1, Image: image}
+		role, ordinals, hasOrdinals := strings.Cut(nodes, ":")
+		switch role {
+		case "root", "validator", "api", "archive":
+		default:
+			return nil, fmt.Errorf("unknown role '%s' in image override '%s'", role, value)
+		}
+		override.Role = role
+
+		if hasOrdinals {
+			from, to, isRange := strings.Cut(ordinals, "-")
+			first, err := strconv.ParseInt(from, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ordinal in image override '%s': %w", value, err)
+			}
+			override.From = int32(first)
+			override.To = int32(first)
+			if isRange {
+				last, err := strconv.ParseInt(to, 10, 32)
+				if err != nil {
+					return nil, fmt.Errorf("invalid ordinal in image override '%s': %w", value, err)
+				}
+				if last < first {
+					return nil, fmt.Errorf("invalid ordinal range in image override '%s'", value)
+				}
+				override.To = int32(last)
+			}
 		}
 
-		err = k8s.CreateIngress(ctx, k, k8sConfig, ingAnnotations)
+		overrides = append(overrides, override)
+	}
+	return overrides, nil
+}
+
+// nodeConfigFromFlags merges the node flags and chain configs of all nodes with the ones of role
+func nodeConfigFromFlags(cmd *cobra.Command, role string) (version1.K8sNodeConfig, error) {
+	config := version1.K8sNodeConfig{
+		Flags:        map[string]string{},
+		ChainConfigs: map[string]string{},
+	}
+
+	for _, name := range []string{"node-flag", role + "-node-flag"} {
+		values, err := cmd.Flags().GetStringArray(name)
 		if err != nil {
-			return err
+			return version1.K8sNodeConfig{}, err
 		}
+		for _, value := range values {
+			flag, flagValue, ok := strings.Cut(value, "=")
+			if !ok || flag == "" {
+				return version1.K8sNodeConfig{}, fmt.Errorf("invalid --%s '%s', expected <flag>=<value>", name, value)
+			}
+			config.Flags[strings.TrimPrefix(flag, "--")] = flagValue
+		}
+	}
+	err := k8s.ValidateNodeFlags(config.Flags)
+	if err != nil {
+		return version1.K8sNodeConfig{}, err
+	}
 
-		err = k8s.RegisterValidators(ctx, kRest, k8sConfig, network.Stakers[numInitialStakers:numValidators], true)
+	for _, name := range []string{"chain-config", role + "-chain-config"} {
+		values, err := cmd.Flags().GetStringArray(name)
 		if err != nil {
-			return err
+			return version1.K8sNodeConfig{}, err
+		}
+		for _, value := range values {
+			chain, file, ok := strings.Cut(value, "=")
+			if !ok || chain == "" {
+				return version1.K8sNodeConfig{}, fmt.Errorf("invalid --%s '%s', expected <chain>=<json file>", name, value)
+			}
+			raw, err := os.ReadFile(file)
+			if err != nil {
+				return version1.K8sNodeConfig{}, err
+			}
+			if !json.Valid(raw) {
+				return version1.K8sNodeConfig{}, fmt.Errorf("chain config %s is not valid json", file)
+			}
+			config.ChainConfigs[chain] = string(raw)
 		}
+	}
 
-		return nil
-	},
+	return config, nil
+}
+
+func storageFromFlags(cmd *cobra.Command, role string) (version1.K8sStorage, error) {
+	size, err := cmd.Flags().GetString(role + "-storage")
+	if err != nil {
+		return version1.K8sStorage{}, err
+	}
+	quantity, err := resource.ParseQuantity(size)
+	if err != nil {
+		return version1.K8sStorage{}, fmt.Errorf("invalid storage size for %s: %w", role, err)
+	}
+
+	storageClass, err := cmd.Flags().GetString(role + "-storage-class")
+	if err != nil {
+		return version1.K8sStorage{}, err
+	}
+
+	accessMode, err := cmd.Flags().GetString(role + "-access-mode")
+	if err != nil {
+		return version1.K8sStorage{}, err
+	}
+	switch v1.PersistentVolumeAccessMode(accessMode) {
+	case v1.ReadWriteOnce, v1.ReadWriteOncePod, v1.ReadWriteMany, v1.ReadOnlyMany:
+	default:
+		return version1.K8sStorage{}, fmt.Errorf("unknown access mode for %s: %s", role, accessMode)
+	}
+
+	return version1.K8sStorage{
+		StorageClass: storageClass,
+		Size:         quantity,
+		AccessMode:   v1.PersistentVolumeAccessMode(accessMode),
+	}, nil
+}
+
+func probeFromFlags(cmd *cobra.Command, role string) (version1.K8sProbe, error) {
+	startupTimeout, err := cmd.Flags().GetDuration(role + "-startup-timeout")
+	if err != nil {
+		return version1.K8sProbe{}, err
+	}
+	livenessTimeout, err := cmd.Flags().GetDuration(role + "-liveness-timeout")
+	if err != nil {
+		return version1.K8sProbe{}, err
+	}
+	return version1.K8sProbe{
+		StartupTimeout:  startupTimeout,
+		LivenessTimeout: livenessTimeout,
+	}, nil
+}
+
+// addSecretProviderFlags adds the flags of stakerSecretsFromFlags and secretProviderFromFlags
+func addSecretProviderFlags(cmd *cobra.Command) {
+	cmd.Flags().String("secret-provider", k8s.SECRET_PROVIDER_KUBERNETES, "where the staker certificates and keys are written to (kubernetes|vault), vault needs --external-secret-store")
+	cmd.Flags().String("secret-path", "camktncr", "path of the staker secrets in vault and the external secret store")
+	cmd.Flags().String("vault-address", "", fmt.Sprintf("address of vault (defaults to $%s)", VAULT_ADDR_ENV))
+	cmd.Flags().String("vault-token", "", fmt.Sprintf("token to write to vault with (defaults to $%s)", VAULT_TOKEN_ENV))
+	cmd.Flags().String("vault-mount", "secret", "mount of the kv v2 secrets engine in vault")
+	cmd.Flags().String("external-secret-store", "", "sync the staker secrets into the namespace with the external secrets operator from this store")
+	cmd.Flags().String("external-secret-store-kind", version1.EXTERNAL_SECRET_STORE, "kind of the external secret store (SecretStore|ClusterSecretStore)")
+	cmd.Flags().Bool("exclude-private-keys", false, "never write the funded private keys of the stakers into the cluster, validators beyond the initial stakers then have to be registered from outside")
+}
+
+func stakerSecretsFromFlags(cmd *cobra.Command) (version1.K8sStakerSecrets, error) {
+	store, err := cmd.Flags().GetString("external-secret-store")
+	if err != nil {
+		return version1.K8sStakerSecrets{}, err
+	}
+	storeKind, err := cmd.Flags().GetString("external-secret-store-kind")
+	if err != nil {
+		return version1.K8sStakerSecrets{}, err
+	}
+	switch storeKind {
+	case version1.EXTERNAL_SECRET_STORE, version1.EXTERNAL_CLUSTER_SECRET_STORE:
+	default:
+		return version1.K8sStakerSecrets{}, fmt.Errorf("unknown external secret store kind '%s'", storeKind)
+	}
+	path, err := cmd.Flags().GetString("secret-path")
+	if err != nil {
+		return version1.K8sStakerSecrets{}, err
+	}
+	excludePrivateKeys, err := cmd.Flags().GetBool("exclude-private-keys")
+	if err != nil {
+		return version1.K8sStakerSecrets{}, err
+	}
+
+	return version1.K8sStakerSecrets{
+		ExternalSecretStore:     store,
+		ExternalSecretStoreKind: storeKind,
+		Path:                    path,
+		ExcludePrivateKeys:      excludePrivateKeys,
+	}, nil
+}
+
+// secretProviderFromFlags returns the provider the staker secrets are written with. Only the
+// kubernetes provider writes into the namespace, the others need an external secret store
+func secretProviderFromFlags(cmd *cobra.Command, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig) (k8s.SecretProvider, error) {
+	provider, err := cmd.Flags().GetString("secret-provider")
+	if err != nil {
+		return nil, err
+	}
+
+	store := k8sConfig.StakerSecrets.ExternalSecretStore
+	switch provider {
+	case k8s.SECRET_PROVIDER_KUBERNETES:
+		if store != "" {
+			return nil, fmt.Errorf("--external-secret-store cannot be combined with the %s secret provider", provider)
+		}
+	case k8s.SECRET_PROVIDER_VAULT:
+		if store == "" {
+			return nil, fmt.Errorf("the %s secret provider needs --external-secret-store so the nodes can read their certificates", provider)
+		}
+	default:
+		return nil, fmt.Errorf("unknown secret provider '%s'", provider)
+	}
+
+	switch provider {
+	case k8s.SECRET_PROVIDER_VAULT:
+		address, err := cmd.Flags().GetString("vault-address")
+		if err != nil {
+			return nil, err
+		}
+		if address == "" {
+			address = os.Getenv(VAULT_ADDR_ENV)
+		}
+		token, err := cmd.Flags().GetString("vault-token")
+		if err != nil {
+			return nil, err
+		}
+		if token == "" {
+			token = os.Getenv(VAULT_TOKEN_ENV)
+		}
+		if address == "" || token == "" {
+			return nil, fmt.Errorf("the vault secret provider needs --vault-address and --vault-token or %s and %s", VAULT_ADDR_ENV, VAULT_TOKEN_ENV)
+		}
+		mount, err := cmd.Flags().GetString("vault-mount")
+		if err != nil {
+			return nil, err
+		}
+		return k8s.NewVaultSecretProvider(address, token, mount, k8sConfig.StakerSecrets.Path), nil
+	}
+	return k8s.NewKubernetesSecretProvider(clientset, k8sConfig), nil
+}
+
+// createRun is the state shared by the steps of create
+type createRun struct {
+	k8sConfig         version1.K8sConfig
+	kRest             *rest.Config
+	k                 *kubernetes.Clientset
+	network           *version1.Network
+	networkName       string
+	storeNetwork      bool
+	passphrase        string
+	reuseGenesis      bool
+	pullSecretName    string
+	tlsSecretName     string
+	secretProvider    k8s.SecretProvider
+	numValidators     uint64
+	numInitialStakers int
+	numApiNodes       uint64
+	numArchiveNodes   uint64
+	nodeRoutes        bool
+	ingAnnotations    map[string]string
+
+	// set by the steps
+	genesisConfig *genesis.UnparsedConfig
+	registered    []k8s.RegisteredValidator
+}
+
+// createSteps are the steps of create in the order they run, every step has to be safe to rerun
+// and steps that are disabled by flags do nothing
+func createSteps(run *createRun) []k8s.Step {
+	return []k8s.Step{
+		{Name: "network-policies", Run: func(ctx context.Context) error {
+			if !run.k8sConfig.NetworkPolicies.Enabled {
+				return nil
+			}
+			return k8s.CreateNetworkPolicies(ctx, run.k, run.k8sConfig)
+		}},
+		{Name: "store-network", Run: func(ctx context.Context) error {
+			if !run.storeNetwork {
+				return nil
+			}
+			return k8s.StoreNetwork(ctx, run.k, run.k8sConfig, run.network, run.passphrase)
+		}},
+		{Name: "copy-secrets", Run: func(ctx context.Context) error {
+			err := k8s.CopySecretFromDefaultNamespace(ctx, run.k, run.k8sConfig, run.pullSecretName)
+			if err != nil {
+				return err
+			}
+			return k8s.CopySecretFromDefaultNamespace(ctx, run.k, run.k8sConfig, run.tlsSecretName)
+		}},
+		{Name: "genesis", Run: func(ctx context.Context) error {
+			if run.reuseGenesis {
+				existing, err := k8s.GetNetworkGenesis(ctx, run.k, run.k8sConfig)
+				if err != nil {
+					return fmt.Errorf("could not reuse genesis: %w", err)
+				}
+				if existing.NetworkID != run.k8sConfig.NetworkID {
+					return fmt.Errorf("could not reuse genesis: network id %d of the stored genesis does not match %d of %s.json", existing.NetworkID, run.k8sConfig.NetworkID, run.networkName)
+				}
+				run.genesisConfig = existing
+				return nil
+			}
+
+			now := time.Now().Unix()
+			built := version1.BuildGenesisConfig(run.network.GenesisConfig.Allocations, uint64(now), run.network.Stakers[:run.numValidators], run.networkName, uint64(run.network.GenesisConfig.NetworkID))
+			run.genesisConfig = &built
+			return k8s.CreateNetworkConfigMap(ctx, run.k, built, run.k8sConfig)
+		}},
+		{Name: "scripts", Run: func(ctx context.Context) error {
+			return k8s.CreateScriptsConfigMap(ctx, run.k, run.k8sConfig)
+		}},
+		{Name: "node-config", Run: func(ctx context.Context) error {
+			return k8s.CreateNodeConfigMap(ctx, run.k, run.k8sConfig)
+		}},
+		{Name: "staker-secrets", Run: func(ctx context.Context) error {
+			return k8s.CreateStakerSecrets(ctx, run.kRest, run.k, run.secretProvider, run.network.Stakers, run.k8sConfig)
+		}},
+		{Name: "root", Run: func(ctx context.Context) error {
+			return k8s.CreateRootNode(ctx, run.kRest, run.k, run.k8sConfig)
+		}},
+		{Name: "validators", Run: func(ctx context.Context) error {
+			return k8s.CreateValidators(ctx, run.kRest, run.k, run.k8sConfig, int32(run.numValidators)-1)
+		}},
+		{Name: "api-nodes", Run: func(ctx context.Context) error {
+			return k8s.CreateApiNodes(ctx, run.kRest, run.k, run.k8sConfig, int32(run.numApiNodes))
+		}},
+		{Name: "archive-nodes", Run: func(ctx context.Context) error {
+			if run.numArchiveNodes == 0 {
+				return nil
+			}
+			return k8s.CreateArchiveNodes(ctx, run.kRest, run.k, run.k8sConfig, int32(run.numArchiveNodes))
+		}},
+		{Name: "ingress", Run: func(ctx context.Context) error {
+			err := k8s.CreateIngress(ctx, run.k, run.k8sConfig, run.ingAnnotations)
+			if err != nil || !run.nodeRoutes {
+				return err
+			}
+			return k8s.CreateNodeIngress(ctx, run.k, run.k8sConfig, run.network.Stakers[:run.numValidators], int32(run.numApiNodes), int32(run.numArchiveNodes), run.ingAnnotations)
+		}},
+		{Name: "monitoring", Run: func(ctx context.Context) error {
+			if run.k8sConfig.EnableDashboards {
+				err := k8s.CreateDashboards(ctx, run.k, run.k8sConfig)
+				if err != nil {
+					return err
+				}
+			}
+			if run.k8sConfig.EnableAlerts {
+				return k8s.CreateAlertRules(ctx, run.kRest, run.k8sConfig)
+			}
+			return nil
+		}},
+		{Name: "register-validators", Run: func(ctx context.Context) error {
+			// registering imports the private keys into the keystore of the root node
+			if run.k8sConfig.StakerSecrets.ExcludePrivateKeys {
+				for _, s := range run.network.Stakers[run.numInitialStakers:run.numValidators] {
+					log.Printf("private keys are excluded, %s has to be registered as validator from outside of the cluster\n", s.NodeID)
+				}
+				return nil
+			}
+			var err error
+			run.registered, err = k8s.RegisterValidators(ctx, run.kRest, run.k8sConfig, run.network.Stakers[run.numInitialStakers:run.numValidators], true)
+			return err
+		}},
+	}
 }
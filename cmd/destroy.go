@@ -7,20 +7,26 @@
 package cmd
 
 import (
+	"fmt"
 	"time"
 
 	"chain4travel.com/camktncr/pkg"
-	"chain4travel.com/camktncr/pkg/version1"
 	"chain4travel.com/camktncr/pkg/version1/k8s"
 
 	"github.com/spf13/cobra"
 )
 
+func init() {
+	destroyCmd.Flags().Bool("force", false, "destroy the network even if the namespace is not owned by camktncr")
+	destroyCmd.Flags().Bool("delete-namespace", false, "delete the namespace of the network and wait for its termination (only if it was created by camktncr)")
+}
+
 var destroyCmd = &cobra.Command{
 	Use:   "destroy <network-name>",
 	Short: "destroy the cluster",
 	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
+		start := time.Now()
 		networkName := args[0]
 
 		kubeconfig, err := cmd.Flags().GetString("kubeconfig")
@@ -33,21 +39,53 @@ var destroyCmd = &cobra.Command{
 			return err
 		}
 
-		k8sConfig := version1.K8sConfig{
-			K8sPrefix: networkName,
-			Namespace: networkName,
-			Labels: map[string]string{
-				"network": networkName,
-			},
+		force, err := cmd.Flags().GetBool("force")
+		if err != nil {
+			return err
+		}
+
+		deleteNamespace, err := cmd.Flags().GetBool("delete-namespace")
+		if err != nil {
+			return err
+		}
+
+		k8sConfig := networkK8sConfig(networkName)
+
+		// --force only skips the check for the resources of the network, namespaces that were not
+		// created by camktncr are never deleted
+		err = k8s.CheckNamespaceOwnership(cmd.Context(), k, k8sConfig)
+		if err != nil && deleteNamespace {
+			return fmt.Errorf("--delete-namespace only deletes namespaces created by camktncr, even with --force: %w", err)
+		}
+		if err != nil && !force {
+			return err
 		}
 
-		err = k8s.DeleteCluster(cmd.Context(), kRest, k, k8sConfig, false)
+		ctx, unlock, err := lockNetwork(cmd.Context(), k, k8sConfig, "destroy")
 		if err != nil {
 			return err
 		}
+		defer unlock()
 
-		time.Sleep(20 * time.Second)
+		err = k8s.DeleteCluster(ctx, kRest, k, k8sConfig, false)
+		if err != nil {
+			return err
+		}
+
+		if deleteNamespace {
+			err = k8s.DeleteNamespace(ctx, k, k8sConfig)
+			if err != nil {
+				return err
+			}
+		} else {
+			time.Sleep(20 * time.Second)
+		}
 
-		return nil
+		return printResult(cmd, destroyResult{
+			Network:          networkName,
+			Namespace:        k8sConfig.Namespace,
+			DeletedNamespace: deleteNamespace,
+			Duration:         duration(time.Since(start)),
+		})
 	},
 }
@@ -24,6 +24,7 @@ func init() {
 	generateCmd.Flags().Uint64("num-initial-stakers", 5, "number of initial stakers")
 	generateCmd.Flags().Uint64("default-stake", 2e5, "initial stake for each validator")
 	generateCmd.Flags().Bool("override", false, "overwrite and delete existing data")
+	generateCmd.Flags().String("network-id", "", fmt.Sprintf("network id of the genesis as number, network-<number> or name, e.g. kopernikus (defaults to %d, %d with --docker-compose)", version1.DEFAULT_NETWORK_ID, version1.DOCKER_COMPOSE_LOCAL_NETWORK_ID))
 
 	// docker-compose custom local
 	generateCmd.Flags().Bool("docker-compose", false, "generate docker-compose instead of k8s")
@@ -39,6 +40,7 @@ var generateCmd = &cobra.Command{
 	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 
+		start := time.Now()
 		networkName := args[0]
 
 		override, err := cmd.Flags().GetBool("override")
@@ -73,10 +75,21 @@ var generateCmd = &cobra.Command{
 			return err
 		}
 
-		networkId := 1002
+		networkIdFlag, err := cmd.Flags().GetString("network-id")
+		if err != nil {
+			return err
+		}
+		networkId := uint32(version1.DEFAULT_NETWORK_ID)
 		if isDockerCompose {
 			networkId = version1.DOCKER_COMPOSE_LOCAL_NETWORK_ID
 		}
+		if networkIdFlag != "" {
+			networkId, err = version1.ParseNetworkID(networkIdFlag)
+			if err != nil {
+				return err
+			}
+		}
+
 		networkConfig := version1.NetworkConfig{
 			NumStakers:        numStakers,
 			NetworkID:         uint64(networkId),
@@ -113,6 +126,21 @@ var generateCmd = &cobra.Command{
 			}
 		}
 
-		return nil
+		result := generateResult{
+			Network:     networkName,
+			NetworkID:   network.GenesisConfig.NetworkID,
+			NetworkFile: networkPath,
+			Stakers:     make([]stakerResult, len(network.Stakers)),
+			Duration:    duration(time.Since(start)),
+		}
+		for i, s := range network.Stakers {
+			result.Stakers[i] = stakerResult{
+				NodeID:        s.NodeID.String(),
+				PublicAddress: s.PublicAddress,
+				CChainAddress: s.CChainAddress,
+				Initial:       uint64(i) < numInitialStakers,
+			}
+		}
+		return printResult(cmd, result)
 	},
 }
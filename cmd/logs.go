@@ -0,0 +1,146 @@
+/*
+ * logs.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+
+	"chain4travel.com/camktncr/pkg"
+	"chain4travel.com/camktncr/pkg/version1/k8s"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+)
+
+func init() {
+	logsCmd.Flags().String("role", "", "only show logs of this role (root|validator|api|archive)")
+	logsCmd.Flags().String("node", "", "only show logs of this node, by NodeID, pod name or <type>-<ordinal>")
+	logsCmd.Flags().Duration("since", 0, "only show logs newer than this duration, e.g. 10m")
+	logsCmd.Flags().String("grep", "", "only show lines matching this regular expression")
+	logsCmd.Flags().Bool("json", false, "print every line as a json object")
+	logsCmd.Flags().BoolP("follow", "f", true, "keep streaming new log lines")
+	logsCmd.Flags().String("bundle", "", "write the logs, pod status and events to this .tar.gz file instead of streaming them")
+}
+
+var logsCmd = &cobra.Command{
+	Use:   "logs <network-name>",
+	Short: "streams the logs of all nodes of a network prefixed with their role, ordinal and NodeID",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		networkName := args[0]
+
+		kubeconfig, err := cmd.Flags().GetString("kubeconfig")
+		if err != nil {
+			return err
+		}
+
+		role, err := cmd.Flags().GetString("role")
+		if err != nil {
+			return err
+		}
+		switch role {
+		case "", "root", "validator", "api", "archive":
+		default:
+			return fmt.Errorf("unknown role '%s'", role)
+		}
+
+		node, err := cmd.Flags().GetString("node")
+		if err != nil {
+			return err
+		}
+
+		since, err := cmd.Flags().GetDuration("since")
+		if err != nil {
+			return err
+		}
+
+		grep, err := cmd.Flags().GetString("grep")
+		if err != nil {
+			return err
+		}
+		var grepRegexp *regexp.Regexp
+		if grep != "" {
+			grepRegexp, err = regexp.Compile(grep)
+			if err != nil {
+				return fmt.Errorf("invalid --grep: %w", err)
+			}
+		}
+
+		jsonOutput, err := cmd.Flags().GetBool("json")
+		if err != nil {
+			return err
+		}
+
+		follow, err := cmd.Flags().GetBool("follow")
+		if err != nil {
+			return err
+		}
+
+		bundle, err := cmd.Flags().GetString("bundle")
+		if err != nil {
+			return err
+		}
+
+		_, k, err := pkg.InitClientSet(kubeconfig)
+		if err != nil {
+			return err
+		}
+
+		options := k8s.LogOptions{
+			Role:   role,
+			Node:   node,
+			Since:  since,
+			Grep:   grepRegexp,
+			Follow: follow,
+		}
+		k8sConfig := networkK8sConfig(networkName)
+
+		if bundle != "" {
+			f, err := os.Create(bundle)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			err = k8s.WriteLogBundle(cmd.Context(), k, k8sConfig, options, f)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("wrote log bundle to %s\n", bundle)
+			return nil
+		}
+
+		lines := make(chan k8s.LogLine)
+		g, ctx := errgroup.WithContext(cmd.Context())
+		g.Go(func() error {
+			defer close(lines)
+			return k8s.StreamLogs(ctx, k, k8sConfig, options, lines)
+		})
+		g.Go(func() error {
+			encoder := json.NewEncoder(os.Stdout)
+			for line := range lines {
+				if jsonOutput {
+					err := encoder.Encode(line)
+					if err != nil {
+						return err
+					}
+					continue
+				}
+				prefix := line.Name()
+				if line.NodeID != "" {
+					prefix = fmt.Sprintf("%s %s", prefix, line.NodeID)
+				}
+				fmt.Printf("[%s] %s\n", prefix, line.Line)
+			}
+			return nil
+		})
+
+		return g.Wait()
+	},
+}
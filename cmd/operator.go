@@ -0,0 +1,162 @@
+/*
+ * operator.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package cmd
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"chain4travel.com/camktncr/pkg/version1/api/v1alpha1"
+	"chain4travel.com/camktncr/pkg/version1/k8s"
+	"chain4travel.com/camktncr/pkg/version1/operator"
+	"github.com/spf13/cobra"
+	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2/klogr"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+const OPERATOR_LEADER_ELECTION_ID = "camktncr-operator.camino.chain4travel.com"
+
+func init() {
+	operatorCmd.Flags().String("kubeconfig", "", "absolute path to the kubeconfig file (empty uses the in-cluster configuration)")
+	operatorCmd.Flags().String("namespace", "", "only reconcile networks in this namespace (empty watches all namespaces)")
+	operatorCmd.Flags().Bool("install-crds", true, "create or update the CaminoNetwork crd on startup")
+	operatorCmd.Flags().String("metrics-bind-address", ":8080", "address the metrics endpoint binds to (0 disables it)")
+	operatorCmd.Flags().String("health-probe-bind-address", ":8081", "address the health endpoints bind to")
+	operatorCmd.Flags().Bool("leader-elect", false, "enable leader election to run more than one replica")
+}
+
+var operatorCmd = &cobra.Command{
+	Use:   "operator",
+	Short: "reconciles CaminoNetwork resources",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		kubeconfig, err := cmd.Flags().GetString("kubeconfig")
+		if err != nil {
+			return err
+		}
+		namespace, err := cmd.Flags().GetString("namespace")
+		if err != nil {
+			return err
+		}
+		installCrds, err := cmd.Flags().GetBool("install-crds")
+		if err != nil {
+			return err
+		}
+		metricsAddress, err := cmd.Flags().GetString("metrics-bind-address")
+		if err != nil {
+			return err
+		}
+		probeAddress, err := cmd.Flags().GetString("health-probe-bind-address")
+		if err != nil {
+			return err
+		}
+		leaderElect, err := cmd.Flags().GetBool("leader-elect")
+		if err != nil {
+			return err
+		}
+
+		// BuildConfigFromFlags falls back to the in-cluster configuration without a kubeconfig
+		restConfig, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+		if err != nil {
+			return err
+		}
+		clientset, err := kubernetes.NewForConfig(restConfig)
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		if installCrds {
+			err = installCrd(ctx, restConfig)
+			if err != nil {
+				return err
+			}
+		}
+
+		scheme := runtime.NewScheme()
+		err = clientgoscheme.AddToScheme(scheme)
+		if err != nil {
+			return err
+		}
+		err = v1alpha1.AddToScheme(scheme)
+		if err != nil {
+			return err
+		}
+
+		ctrl.SetLogger(klogr.New())
+
+		mgr, err := ctrl.NewManager(restConfig, ctrl.Options{
+			Scheme:                 scheme,
+			Namespace:              namespace,
+			MetricsBindAddress:     metricsAddress,
+			HealthProbeBindAddress: probeAddress,
+			LeaderElection:         leaderElect,
+			LeaderElectionID:       OPERATOR_LEADER_ELECTION_ID,
+		})
+		if err != nil {
+			return err
+		}
+
+		reconciler := &operator.Reconciler{
+			Client:     mgr.GetClient(),
+			RestConfig: restConfig,
+			Clientset:  clientset,
+		}
+		err = reconciler.SetupWithManager(mgr)
+		if err != nil {
+			return err
+		}
+
+		log.Println("starting operator")
+		return mgr.Start(ctx)
+	},
+}
+
+// installCrd creates the CaminoNetwork crd or updates it to the version of this binary
+func installCrd(ctx context.Context, restConfig *rest.Config) error {
+	crd, err := v1alpha1.CustomResourceDefinition()
+	if err != nil {
+		return err
+	}
+
+	client, err := apiextensionsclient.NewForConfig(restConfig)
+	if err != nil {
+		return err
+	}
+	crdClient := client.ApiextensionsV1().CustomResourceDefinitions()
+
+	existing, err := crdClient.Get(ctx, crd.Name, metav1.GetOptions{})
+	if k8sErrors.IsNotFound(err) {
+		_, err = crdClient.Create(ctx, crd, metav1.CreateOptions{
+			FieldManager: k8s.FIELD_MANAGER_STRING,
+		})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	crd.ResourceVersion = existing.ResourceVersion
+	_, err = crdClient.Update(ctx, crd, metav1.UpdateOptions{
+		FieldManager: k8s.FIELD_MANAGER_STRING,
+	})
+	return err
+}
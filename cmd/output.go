@@ -0,0 +1,204 @@
+/*
+ * output.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"chain4travel.com/camktncr/pkg/version1/k8s"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	OUTPUT_TEXT = "text"
+	OUTPUT_JSON = "json"
+	OUTPUT_YAML = "yaml"
+)
+
+// result is printed to stdout when a command finished, progress is written to stderr
+type result interface {
+	printText(w io.Writer)
+}
+
+func validateOutput(cmd *cobra.Command, args []string) error {
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+	switch output {
+	case OUTPUT_TEXT, OUTPUT_JSON, OUTPUT_YAML:
+		return nil
+	}
+	return fmt.Errorf("unknown output format '%s' (text|json|yaml)", output)
+}
+
+func printResult(cmd *cobra.Command, r result) error {
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+
+	switch output {
+	case OUTPUT_JSON:
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(r)
+	case OUTPUT_YAML:
+		out, err := yaml.Marshal(r)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(out)
+		return err
+	default:
+		r.printText(os.Stdout)
+		return nil
+	}
+}
+
+// duration is serialized in its human readable form
+type duration time.Duration
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).Round(time.Millisecond).String())
+}
+
+func (d duration) String() string {
+	return time.Duration(d).Round(time.Millisecond).String()
+}
+
+type stakerResult struct {
+	NodeID        string `json:"nodeId"`
+	PublicAddress string `json:"publicAddress"`
+	CChainAddress string `json:"cChainAddress"`
+	Initial       bool   `json:"initial"`
+}
+
+type generateResult struct {
+	Network     string         `json:"network"`
+	NetworkID   uint32         `json:"networkId"`
+	NetworkFile string         `json:"networkFile"`
+	Stakers     []stakerResult `json:"stakers"`
+	Duration    duration       `json:"duration"`
+}
+
+func (r generateResult) printText(w io.Writer) {
+	fmt.Fprintf(w, "generated %s (network id %d) with %d stakers in %s\n", r.NetworkFile, r.NetworkID, len(r.Stakers), r.Duration)
+}
+
+type bootstrapResult struct {
+	NetworkID uint32   `json:"networkId"`
+	IDs       []string `json:"ids"`
+	IPs       []string `json:"ips"`
+	Genesis   string   `json:"genesis"`
+}
+
+type createResult struct {
+	Network   string `json:"network"`
+	Namespace string `json:"namespace"`
+	// Resources lists the created workloads as <kind>/<name>
+	Resources  []string                  `json:"resources"`
+	Endpoints  map[string]string         `json:"endpoints"`
+	Nodes      []k8s.Node                `json:"nodes"`
+	Registered []k8s.RegisteredValidator `json:"registeredValidators"`
+	Bootstrap  *bootstrapResult          `json:"bootstrap,omitempty"`
+	Steps      []k8s.StepResult          `json:"steps"`
+	Duration   duration                  `json:"duration"`
+}
+
+func (r createResult) printText(w io.Writer) {
+	fmt.Fprintf(w, "created network %s in namespace %s in %s\n", r.Network, r.Namespace, r.Duration)
+	for _, step := range r.Steps {
+		fmt.Fprintf(w, "%-20s %-10s %s\n", step.Name, step.Status, step.Duration)
+	}
+	for _, name := range []string{"api", "static", "archive"} {
+		if endpoint, ok := r.Endpoints[name]; ok {
+			fmt.Fprintf(w, "%-8s %s\n", name, endpoint)
+		}
+	}
+	for _, n := range r.Nodes {
+		fmt.Fprintf(w, "%-14s %-42s %s\n", n.Name(), n.NodeID, n.Image)
+	}
+	for _, v := range r.Registered {
+		if v.TxID != "" {
+			fmt.Fprintf(w, "registered validator %s with tx %s\n", v.NodeID, v.TxID)
+		}
+	}
+	if r.Bootstrap != nil {
+		fmt.Fprintln(w, "external nodes can join the network with:")
+		fmt.Fprintf(w, "--network-id=%d --genesis=%s --bootstrap-ids=%s --bootstrap-ips=%s\n", r.Bootstrap.NetworkID, r.Bootstrap.Genesis, strings.Join(r.Bootstrap.IDs, ","), strings.Join(r.Bootstrap.IPs, ","))
+	}
+}
+
+type destroyResult struct {
+	Network          string   `json:"network"`
+	Namespace        string   `json:"namespace"`
+	DeletedNamespace bool     `json:"deletedNamespace"`
+	Duration         duration `json:"duration"`
+}
+
+func (r destroyResult) printText(w io.Writer) {
+	if r.DeletedNamespace {
+		fmt.Fprintf(w, "destroyed network %s and deleted namespace %s in %s\n", r.Network, r.Namespace, r.Duration)
+		return
+	}
+	fmt.Fprintf(w, "destroyed network %s in %s\n", r.Network, r.Duration)
+}
+
+type snapshotResult struct {
+	Snapshot  string `json:"snapshot"`
+	Network   string `json:"network"`
+	Namespace string `json:"namespace"`
+}
+
+func (r snapshotResult) printText(w io.Writer) {
+	fmt.Fprintf(w, "created snapshot %s\n", r.Snapshot)
+}
+
+type restoreResult struct {
+	Network  string `json:"network"`
+	Snapshot string `json:"snapshot"`
+	// Source is the network the snapshot was taken from
+	Source string `json:"source"`
+}
+
+func (r restoreResult) printText(w io.Writer) {
+	fmt.Fprintf(w, "restored %s from %s, start it with: camktncr k8s create %s --reuse-genesis\n", r.Network, r.Snapshot, r.Network)
+}
+
+type pullResult struct {
+	Network       string `json:"network"`
+	NetworkFile   string `json:"networkFile"`
+	K8sConfigFile string `json:"k8sConfigFile"`
+}
+
+func (r pullResult) printText(w io.Writer) {
+	fmt.Fprintf(w, "pulled %s to %s, the k8s configuration it was created with is in %s\n", r.Network, r.NetworkFile, r.K8sConfigFile)
+}
+
+type proxyEndpoint struct {
+	Node     string `json:"node"`
+	Pod      string `json:"pod"`
+	NodeID   string `json:"nodeId,omitempty"`
+	Endpoint string `json:"endpoint"`
+}
+
+type proxyResult struct {
+	Endpoints []proxyEndpoint `json:"endpoints"`
+}
+
+func (r proxyResult) printText(w io.Writer) {
+	for _, e := range r.Endpoints {
+		fmt.Fprintf(w, "%-16s %-44s %s\n", e.Node, e.NodeID, e.Endpoint)
+	}
+}
@@ -0,0 +1,108 @@
+/*
+ * proxy.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package cmd
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"chain4travel.com/camktncr/pkg"
+	"chain4travel.com/camktncr/pkg/version1/k8s"
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
+)
+
+func init() {
+	proxyCmd.Flags().StringSlice("node", nil, "only forward these nodes, by NodeID, pod name or <type>-<ordinal> (defaults to all nodes)")
+	proxyCmd.Flags().Int("port", k8s.HTTP_PORT, "port of the nodes to forward")
+}
+
+var proxyCmd = &cobra.Command{
+	Use:   "proxy <network-name>",
+	Short: "forwards free local ports to the nodes of a network and prints the local endpoints",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		networkName := args[0]
+
+		kubeconfig, err := cmd.Flags().GetString("kubeconfig")
+		if err != nil {
+			return err
+		}
+
+		nodeNames, err := cmd.Flags().GetStringSlice("node")
+		if err != nil {
+			return err
+		}
+
+		port, err := cmd.Flags().GetInt("port")
+		if err != nil {
+			return err
+		}
+
+		kRest, k, err := pkg.InitClientSet(kubeconfig)
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		k8sConfig := networkK8sConfig(networkName)
+		nodes, err := proxyNodes(ctx, k, networkName, nodeNames)
+		if err != nil {
+			return err
+		}
+
+		result := proxyResult{Endpoints: make([]proxyEndpoint, 0, len(nodes))}
+		for _, node := range nodes {
+			forward, err := k8s.ForwardPort(ctx, kRest, k8sConfig.Namespace, node.Pod, port)
+			if err != nil {
+				return err
+			}
+			defer forward.Close()
+
+			result.Endpoints = append(result.Endpoints, proxyEndpoint{
+				Node:     node.Name(),
+				Pod:      node.Pod,
+				NodeID:   node.NodeID,
+				Endpoint: forward.Endpoint(),
+			})
+		}
+
+		err = printResult(cmd, result)
+		if err != nil {
+			return err
+		}
+
+		log.Println("forwarding, press ctrl+c to stop")
+		<-ctx.Done()
+		return nil
+	},
+}
+
+func proxyNodes(ctx context.Context, k *kubernetes.Clientset, networkName string, nodeNames []string) ([]k8s.Node, error) {
+	nodes, err := k8s.ListNodes(ctx, k, networkK8sConfig(networkName))
+	if err != nil {
+		return nil, err
+	}
+	if len(nodeNames) == 0 {
+		return nodes, nil
+	}
+
+	selected := make([]k8s.Node, 0, len(nodeNames))
+	for _, name := range nodeNames {
+		node, err := k8s.FindNode(nodes, name)
+		if err != nil {
+			return nil, err
+		}
+		selected = append(selected, node)
+	}
+	return selected, nil
+}
@@ -0,0 +1,115 @@
+/*
+ * pull.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"chain4travel.com/camktncr/pkg"
+	"chain4travel.com/camktncr/pkg/version1/k8s"
+	"github.com/spf13/cobra"
+)
+
+const PASSPHRASE_ENV = "CAMKTNCR_PASSPHRASE"
+
+func init() {
+	pullCmd.Flags().String("passphrase", "", fmt.Sprintf("passphrase the network was stored with (defaults to $%s)", PASSPHRASE_ENV))
+	pullCmd.Flags().Bool("overwrite", false, "overwrite an existing local network file")
+}
+
+var pullCmd = &cobra.Command{
+	Use:   "pull <network-name>",
+	Short: "reconstructs the local network file of a network stored in the cluster with 'k8s create --store-network'",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		networkName := args[0]
+
+		kubeconfig, err := cmd.Flags().GetString("kubeconfig")
+		if err != nil {
+			return err
+		}
+
+		passphrase, err := passphraseFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		overwrite, err := cmd.Flags().GetBool("overwrite")
+		if err != nil {
+			return err
+		}
+
+		_, k, err := pkg.InitClientSet(kubeconfig)
+		if err != nil {
+			return err
+		}
+
+		network, k8sConfig, err := k8s.PullNetwork(cmd.Context(), k, networkK8sConfig(networkName), passphrase)
+		if err != nil {
+			return err
+		}
+
+		networkJson, err := json.Marshal(network)
+		if err != nil {
+			return err
+		}
+		k8sConfigJson, err := json.MarshalIndent(k8sConfig, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if !overwrite {
+			flags |= os.O_EXCL
+		}
+
+		networkPath := fmt.Sprintf("%s.json", networkName)
+		err = writeFile(networkPath, networkJson, flags, 0600)
+		if err != nil {
+			return err
+		}
+		k8sConfigPath := fmt.Sprintf("%s-k8s.json", networkName)
+		err = writeFile(k8sConfigPath, k8sConfigJson, flags, 0644)
+		if err != nil {
+			return err
+		}
+
+		return printResult(cmd, pullResult{
+			Network:       networkName,
+			NetworkFile:   networkPath,
+			K8sConfigFile: k8sConfigPath,
+		})
+	},
+}
+
+// passphraseFromFlags reads the network passphrase from --passphrase or the environment
+func passphraseFromFlags(cmd *cobra.Command) (string, error) {
+	passphrase, err := cmd.Flags().GetString("passphrase")
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		passphrase = os.Getenv(PASSPHRASE_ENV)
+	}
+	if passphrase == "" {
+		return "", fmt.Errorf("no passphrase given, use --passphrase or set %s", PASSPHRASE_ENV)
+	}
+	return passphrase, nil
+}
+
+func writeFile(path string, data []byte, flags int, perm os.FileMode) error {
+	f, err := os.OpenFile(path, flags, perm)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(data)
+	return err
+}
@@ -7,19 +7,24 @@
 package cmd
 
 import (
+	"context"
+	"log"
 	"os"
 	"path/filepath"
 
+	"chain4travel.com/camktncr/pkg/version1"
+	"chain4travel.com/camktncr/pkg/version1/k8s"
 	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/util/homedir"
 )
 
-var rootCmd = &cobra.Command{Use: "camktncr", SilenceUsage: true}
+var rootCmd = &cobra.Command{Use: "camktncr", SilenceUsage: true, PersistentPreRunE: validateOutput}
 var k8sCmd = &cobra.Command{Use: "k8s"}
 
 func init() {
 
-	k8sCmd.AddCommand(createCmd, destroyCmd)
+	k8sCmd.AddCommand(createCmd, destroyCmd, snapshotCmd, restoreCmd, pullCmd, logsCmd, proxyCmd, rpcCmd)
 
 	if home := homedir.HomeDir(); home != "" {
 		k8sCmd.PersistentFlags().String("kubeconfig", filepath.Join(home, ".kube", "config"), "(optional) absolute path to the kubeconfig file")
@@ -27,9 +32,50 @@ func init() {
 		k8sCmd.PersistentFlags().String("kubeconfig", "", "absolute path to the kubeconfig file")
 	}
 
+	rootCmd.PersistentFlags().StringP("output", "o", OUTPUT_TEXT, "format of the result printed to stdout (text|json|yaml), progress is written to stderr")
+
 	rootCmd.AddCommand(k8sCmd)
 	rootCmd.AddCommand(generateCmd)
+	rootCmd.AddCommand(operatorCmd)
+
+}
+
+// networkK8sConfig is the minimal configuration to address the resources of an existing network
+func networkK8sConfig(networkName string) version1.K8sConfig {
+	return version1.K8sConfig{
+		K8sPrefix: networkName,
+		Namespace: networkName,
+		Labels: map[string]string{
+			"network": networkName,
+		},
+	}
+}
+
+// lockNetwork takes the cluster side lock of the network, the returned context is canceled when the
+// lock is lost and the returned function releases it
+func lockNetwork(ctx context.Context, k *kubernetes.Clientset, k8sConfig version1.K8sConfig, operation string) (context.Context, func(), error) {
+	lock, err := k8s.AcquireNetworkLock(ctx, k, k8sConfig, operation)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-lock.Lost():
+			log.Println("stopping, lost the lock of the network:", lock.Err())
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
 
+	return ctx, func() {
+		cancel()
+		err := lock.Release(context.Background())
+		if err != nil {
+			log.Println("could not release lock:", err)
+		}
+	}, nil
 }
 
 func Run() {
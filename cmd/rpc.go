@@ -0,0 +1,159 @@
+/*
+ * rpc.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"chain4travel.com/camktncr/pkg"
+	"chain4travel.com/camktncr/pkg/version1/k8s"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+)
+
+func init() {
+	rpcCmd.Flags().StringSlice("node", nil, "send the request to these nodes, by NodeID, pod name or <type>-<ordinal> (defaults to root-0)")
+	rpcCmd.Flags().Bool("all", false, "send the request to all nodes and compare the results")
+}
+
+var rpcCmd = &cobra.Command{
+	Use:   "rpc <network-name> <chain> <method> [params-json]",
+	Short: "sends a json rpc request to nodes of a network",
+	Long: `sends a json rpc request to nodes of a network, e.g.
+
+  camktncr k8s rpc <network-name> P platform.getHeight --all
+  camktncr k8s rpc <network-name> info info.getNodeID --node validator-3
+  camktncr k8s rpc <network-name> C eth_blockNumber '[]'
+
+<chain> is P, X or C for the chains, any other api under /ext like info, health or admin,
+or an absolute path`,
+	Args: cobra.RangeArgs(3, 4),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		networkName := args[0]
+		path := k8s.ChainPath(args[1])
+		method := args[2]
+
+		var params json.RawMessage
+		if len(args) == 4 {
+			params = json.RawMessage(args[3])
+			if !json.Valid(params) {
+				return fmt.Errorf("params are not valid json: %s", args[3])
+			}
+		}
+
+		kubeconfig, err := cmd.Flags().GetString("kubeconfig")
+		if err != nil {
+			return err
+		}
+
+		nodeNames, err := cmd.Flags().GetStringSlice("node")
+		if err != nil {
+			return err
+		}
+
+		all, err := cmd.Flags().GetBool("all")
+		if err != nil {
+			return err
+		}
+		if all && len(nodeNames) > 0 {
+			return fmt.Errorf("--all and --node cannot be combined")
+		}
+		if !all && len(nodeNames) == 0 {
+			nodeNames = []string{"root-0"}
+		}
+
+		kRest, k, err := pkg.InitClientSet(kubeconfig)
+		if err != nil {
+			return err
+		}
+
+		ctx := cmd.Context()
+		nodes, err := proxyNodes(ctx, k, networkName, nodeNames)
+		if err != nil {
+			return err
+		}
+
+		results := make([]*k8s.RPCResponse, len(nodes))
+		callErrs := make([]error, len(nodes))
+
+		g, gCtx := errgroup.WithContext(ctx)
+		for i, node := range nodes {
+			i, node := i, node
+			g.Go(func() error {
+				forward, err := k8s.ForwardPort(gCtx, kRest, networkK8sConfig(networkName).Namespace, node.Pod, k8s.HTTP_PORT)
+				if err != nil {
+					callErrs[i] = err
+					return nil
+				}
+				defer forward.Close()
+
+				results[i], callErrs[i] = k8s.CallRPC(gCtx, forward.Endpoint(), path, method, params)
+				return nil
+			})
+		}
+		err = g.Wait()
+		if err != nil {
+			return err
+		}
+
+		if len(nodes) == 1 {
+			if callErrs[0] != nil {
+				return callErrs[0]
+			}
+			if results[0].Error != nil {
+				return results[0].Error
+			}
+			return printIndented(results[0].Result)
+		}
+
+		distinct := map[string]bool{}
+		for i, node := range nodes {
+			var out string
+			switch {
+			case callErrs[i] != nil:
+				out = "error: " + callErrs[i].Error()
+			case results[i].Error != nil:
+				out = "error: " + results[i].Error.Error()
+			default:
+				var compact bytes.Buffer
+				err := json.Compact(&compact, resultOrNull(results[i].Result))
+				if err != nil {
+					out = "error: " + err.Error()
+				} else {
+					out = compact.String()
+				}
+			}
+			distinct[out] = true
+			fmt.Printf("%-16s %-44s %s\n", node.Name(), node.NodeID, out)
+		}
+
+		if len(distinct) > 1 {
+			fmt.Printf("nodes returned %d different results\n", len(distinct))
+		}
+		return nil
+	},
+}
+
+func printIndented(data json.RawMessage) error {
+	var indented bytes.Buffer
+	err := json.Indent(&indented, resultOrNull(data), "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(indented.String())
+	return nil
+}
+
+// resultOrNull prints methods without a result (e.g. admin calls) as null
+func resultOrNull(data json.RawMessage) json.RawMessage {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return json.RawMessage("null")
+	}
+	return data
+}
@@ -0,0 +1,172 @@
+/*
+ * scheduling.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"chain4travel.com/camktncr/pkg/version1"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/yaml"
+)
+
+// roleSchedulingSpec is the per role part of the scheduling file
+type roleSchedulingSpec struct {
+	Limits v1.ResourceList `json:"limits,omitempty"`
+	version1.K8sScheduling
+}
+
+// schedulingSpec is the content of the file passed with --scheduling-file, e.g.
+//
+//	validator:
+//	  limits: {cpu: "2", memory: 4Gi}
+//	  nodeSpread: required
+//	  tolerations:
+//	  - {key: cloud.google.com/gke-spot, operator: Exists, effect: NoSchedule}
+//	api:
+//	  nodeSelector: {pool: api}
+type schedulingSpec struct {
+	Validator roleSchedulingSpec `json:"validator,omitempty"`
+	Api       roleSchedulingSpec `json:"api,omitempty"`
+	Archive   roleSchedulingSpec `json:"archive,omitempty"`
+}
+
+func addSchedulingFlags(cmd *cobra.Command, role string, defaultNodeSpread string) {
+	cmd.Flags().String(role+"-cpu-limit", "", fmt.Sprintf("cpu limit of the %s (empty means no limit)", role))
+	cmd.Flags().String(role+"-ram-limit", "", fmt.Sprintf("ram limit of the %s (empty means no limit)", role))
+	cmd.Flags().StringToString(role+"-node-selector", nil, fmt.Sprintf("node labels the %s have to be scheduled on", role))
+	cmd.Flags().StringSlice(role+"-tolerations", nil, fmt.Sprintf("taints the %s tolerate in kubectl taint syntax key[=value]:effect", role))
+	cmd.Flags().String(role+"-node-spread", defaultNodeSpread, fmt.Sprintf("spread the %s across k8s nodes (none|preferred|required)", role))
+	cmd.Flags().String(role+"-zone-spread", version1.SPREAD_NONE, fmt.Sprintf("spread the %s across zones (none|preferred|required)", role))
+}
+
+func loadSchedulingSpec(path string) (schedulingSpec, error) {
+	var spec schedulingSpec
+	if path == "" {
+		return spec, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return spec, err
+	}
+	err = yaml.UnmarshalStrict(data, &spec)
+	if err != nil {
+		return spec, fmt.Errorf("could not parse scheduling file %s: %w", path, err)
+	}
+	return spec, nil
+}
+
+// parseToleration parses the kubectl taint syntax key[=value]:effect
+func parseToleration(s string) (v1.Toleration, error) {
+	keyValue, effect, found := strings.Cut(s, ":")
+	if !found || keyValue == "" {
+		return v1.Toleration{}, fmt.Errorf("invalid toleration '%s', expected key[=value]:effect", s)
+	}
+
+	toleration := v1.Toleration{
+		Effect:   v1.TaintEffect(effect),
+		Operator: v1.TolerationOpExists,
+	}
+	switch toleration.Effect {
+	case v1.TaintEffectNoSchedule, v1.TaintEffectPreferNoSchedule, v1.TaintEffectNoExecute:
+	default:
+		return v1.Toleration{}, fmt.Errorf("invalid toleration effect '%s'", effect)
+	}
+
+	key, value, hasValue := strings.Cut(keyValue, "=")
+	toleration.Key = key
+	if hasValue {
+		toleration.Operator = v1.TolerationOpEqual
+		toleration.Value = value
+	}
+	return toleration, nil
+}
+
+func validateSpread(role string, spread string) error {
+	switch spread {
+	case "", version1.SPREAD_NONE, version1.SPREAD_PREFERRED, version1.SPREAD_REQUIRED:
+		return nil
+	}
+	return fmt.Errorf("unknown spread '%s' for %s", spread, role)
+}
+
+// schedulingFromFlags merges the scheduling file with the flags of the role, flags that were set explicitly win
+func schedulingFromFlags(cmd *cobra.Command, role string, spec roleSchedulingSpec) (v1.ResourceList, version1.K8sScheduling, error) {
+	limits := v1.ResourceList{}
+	for k, v := range spec.Limits {
+		limits[k] = v
+	}
+	scheduling := spec.K8sScheduling
+
+	for flag, name := range map[string]v1.ResourceName{"-cpu-limit": v1.ResourceCPU, "-ram-limit": v1.ResourceMemory} {
+		value, err := cmd.Flags().GetString(role + flag)
+		if err != nil {
+			return nil, scheduling, err
+		}
+		if value == "" {
+			continue
+		}
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			return nil, scheduling, fmt.Errorf("invalid --%s%s: %w", role, flag, err)
+		}
+		limits[name] = quantity
+	}
+
+	if cmd.Flags().Changed(role+"-node-selector") || scheduling.NodeSelector == nil {
+		nodeSelector, err := cmd.Flags().GetStringToString(role + "-node-selector")
+		if err != nil {
+			return nil, scheduling, err
+		}
+		if len(nodeSelector) > 0 {
+			scheduling.NodeSelector = nodeSelector
+		}
+	}
+
+	tolerations, err := cmd.Flags().GetStringSlice(role + "-tolerations")
+	if err != nil {
+		return nil, scheduling, err
+	}
+	for _, t := range tolerations {
+		toleration, err := parseToleration(t)
+		if err != nil {
+			return nil, scheduling, err
+		}
+		scheduling.Tolerations = append(scheduling.Tolerations, toleration)
+	}
+
+	if cmd.Flags().Changed(role+"-node-spread") || scheduling.NodeSpread == "" {
+		scheduling.NodeSpread, err = cmd.Flags().GetString(role + "-node-spread")
+		if err != nil {
+			return nil, scheduling, err
+		}
+	}
+	if cmd.Flags().Changed(role+"-zone-spread") || scheduling.ZoneSpread == "" {
+		scheduling.ZoneSpread, err = cmd.Flags().GetString(role + "-zone-spread")
+		if err != nil {
+			return nil, scheduling, err
+		}
+	}
+
+	err = validateSpread(role, scheduling.NodeSpread)
+	if err != nil {
+		return nil, scheduling, err
+	}
+	err = validateSpread(role, scheduling.ZoneSpread)
+	if err != nil {
+		return nil, scheduling, err
+	}
+
+	if len(limits) == 0 {
+		limits = nil
+	}
+	return limits, scheduling, nil
+}
@@ -0,0 +1,180 @@
+/*
+ * snapshot.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"chain4travel.com/camktncr/pkg"
+	"chain4travel.com/camktncr/pkg/version1/k8s"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	snapshotCmd.Flags().String("name", "", "name of the snapshot (defaults to <network-name>-<unix time>)")
+	snapshotCmd.Flags().String("snapshot-class", "", "volume snapshot class to use (empty uses the cluster default)")
+	snapshotCmd.Flags().String("snapshot-namespace", k8s.DEFAULT_SNAPSHOT_NAMESPACE, "namespace the snapshots are kept in, independent of the network")
+	restoreCmd.Flags().String("snapshot-namespace", k8s.DEFAULT_SNAPSHOT_NAMESPACE, "namespace the snapshot is kept in")
+	addSecretProviderFlags(restoreCmd)
+}
+
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot <network-name>",
+	Short: "snapshots the data volumes, genesis and staker secrets of a running network",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		networkName := args[0]
+
+		kubeconfig, err := cmd.Flags().GetString("kubeconfig")
+		if err != nil {
+			return err
+		}
+
+		snapshotName, err := cmd.Flags().GetString("name")
+		if err != nil {
+			return err
+		}
+		if snapshotName == "" {
+			snapshotName = fmt.Sprintf("%s-%d", networkName, time.Now().Unix())
+		}
+
+		snapshotClass, err := cmd.Flags().GetString("snapshot-class")
+		if err != nil {
+			return err
+		}
+
+		snapshotNamespace, err := cmd.Flags().GetString("snapshot-namespace")
+		if err != nil {
+			return err
+		}
+
+		kRest, k, err := pkg.InitClientSet(kubeconfig)
+		if err != nil {
+			return err
+		}
+
+		k8sConfig := networkK8sConfig(networkName)
+
+		ctx, unlock, err := lockNetwork(cmd.Context(), k, k8sConfig, "snapshot")
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		err = k8s.CreateSnapshot(ctx, kRest, k, k8sConfig, snapshotName, snapshotClass, snapshotNamespace)
+		if err != nil {
+			return err
+		}
+
+		return printResult(cmd, snapshotResult{
+			Snapshot:  snapshotName,
+			Network:   networkName,
+			Namespace: snapshotNamespace,
+		})
+	},
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore <snapshot> <new-network-name>",
+	Short: "provisions the volumes, genesis and staker secrets of a new network from a snapshot",
+	Long: `provisions the volumes, genesis and staker secrets of a new network from a snapshot.
+Start the network afterwards with 'k8s create <new-network-name> --reuse-genesis'`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		snapshotName := args[0]
+		networkName := args[1]
+
+		kubeconfig, err := cmd.Flags().GetString("kubeconfig")
+		if err != nil {
+			return err
+		}
+
+		snapshotNamespace, err := cmd.Flags().GetString("snapshot-namespace")
+		if err != nil {
+			return err
+		}
+
+		kRest, k, err := pkg.InitClientSet(kubeconfig)
+		if err != nil {
+			return err
+		}
+
+		k8sConfig := networkK8sConfig(networkName)
+		k8sConfig.StakerSecrets, err = stakerSecretsFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		caps, err := k8s.DiscoverCapabilities(kRest)
+		if err != nil {
+			return err
+		}
+		if k8sConfig.StakerSecrets.ExternalSecretStore != "" && !caps.ExternalSecrets {
+			return fmt.Errorf("external secrets operator crds not found, cannot sync the staker secrets from store '%s'", k8sConfig.StakerSecrets.ExternalSecretStore)
+		}
+
+		secretProvider, err := secretProviderFromFlags(cmd, k, k8sConfig)
+		if err != nil {
+			return err
+		}
+
+		// the lock lives in the namespace of the network, which has to exist to hold it
+		err = k8s.CreateNamespace(cmd.Context(), k, k8sConfig, false)
+		if err != nil {
+			return err
+		}
+
+		ctx, unlock, err := lockNetwork(cmd.Context(), k, k8sConfig, "restore")
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		sourceNetwork, err := k8s.RestoreSnapshot(ctx, kRest, k, secretProvider, snapshotName, snapshotNamespace, k8sConfig)
+		if err != nil {
+			return err
+		}
+
+		// create needs the network file with the stakers and their keys
+		networkPath := fmt.Sprintf("%s.json", networkName)
+		err = copyFile(fmt.Sprintf("%s.json", sourceNetwork), networkPath)
+		if errors.Is(err, os.ErrNotExist) {
+			log.Printf("could not find %s.json, copy the network file of %s to %s before creating the network\n", sourceNetwork, sourceNetwork, networkPath)
+		} else if err != nil && !errors.Is(err, os.ErrExist) {
+			return err
+		}
+
+		return printResult(cmd, restoreResult{
+			Network:  networkName,
+			Snapshot: snapshotName,
+			Source:   sourceNetwork,
+		})
+	},
+}
+
+// copyFile copies src to dst and never overwrites an existing dst
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0700)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	return err
+}
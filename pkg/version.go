@@ -2,6 +2,7 @@ package pkg
 
 import (
 	"fmt"
+	"os"
 	"os/exec"
 	"runtime/debug"
 	"strings"
@@ -18,7 +19,7 @@ var Commit = func() string {
 	cmd := exec.Command("git", "rev-parse", "HEAD")
 	stdout, err := cmd.Output()
 	if err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(os.Stderr, err)
 		return "unknown"
 	}
 
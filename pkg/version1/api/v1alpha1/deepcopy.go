@@ -0,0 +1,105 @@
+/*
+ * deepcopy.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package v1alpha1
+
+import (
+	"chain4travel.com/camktncr/pkg/version1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func copyStringMap(in map[string]string) map[string]string {
+	if in == nil {
+		return nil
+	}
+	out := make(map[string]string, len(in))
+	for k, v := range in {
+		out[k] = v
+	}
+	return out
+}
+
+func copyStrings(in []string) []string {
+	if in == nil {
+		return nil
+	}
+	out := make([]string, len(in))
+	copy(out, in)
+	return out
+}
+
+func (in *CaminoNetworkSpec) DeepCopyInto(out *CaminoNetworkSpec) {
+	*out = *in
+	if in.ImageOverrides != nil {
+		out.ImageOverrides = make([]version1.K8sImageOverride, len(in.ImageOverrides))
+		copy(out.ImageOverrides, in.ImageOverrides)
+	}
+	out.Resources.Validator = in.Resources.Validator.DeepCopy()
+	out.Resources.Api = in.Resources.Api.DeepCopy()
+	out.Resources.Archive = in.Resources.Archive.DeepCopy()
+	out.Ingress.Annotations = copyStringMap(in.Ingress.Annotations)
+	out.NodeConfig.Validator.Flags = copyStringMap(in.NodeConfig.Validator.Flags)
+	out.NodeConfig.Validator.ChainConfigs = copyStringMap(in.NodeConfig.Validator.ChainConfigs)
+	out.NodeConfig.Api.Flags = copyStringMap(in.NodeConfig.Api.Flags)
+	out.NodeConfig.Api.ChainConfigs = copyStringMap(in.NodeConfig.Api.ChainConfigs)
+	out.NodeConfig.Archive.Flags = copyStringMap(in.NodeConfig.Archive.Flags)
+	out.NodeConfig.Archive.ChainConfigs = copyStringMap(in.NodeConfig.Archive.ChainConfigs)
+	out.NetworkPolicies.IngressNamespaces = copyStrings(in.NetworkPolicies.IngressNamespaces)
+	out.NetworkPolicies.MonitoringNamespaces = copyStrings(in.NetworkPolicies.MonitoringNamespaces)
+	out.NetworkPolicies.Allow = copyStrings(in.NetworkPolicies.Allow)
+}
+
+func (in *CaminoNetworkStatus) DeepCopyInto(out *CaminoNetworkStatus) {
+	*out = *in
+	out.Endpoints = copyStringMap(in.Endpoints)
+	out.NodeImages = copyStringMap(in.NodeImages)
+}
+
+func (in *CaminoNetwork) DeepCopyInto(out *CaminoNetwork) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+func (in *CaminoNetwork) DeepCopy() *CaminoNetwork {
+	if in == nil {
+		return nil
+	}
+	out := new(CaminoNetwork)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *CaminoNetwork) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
+
+func (in *CaminoNetworkList) DeepCopyInto(out *CaminoNetworkList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]CaminoNetwork, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+}
+
+func (in *CaminoNetworkList) DeepCopy() *CaminoNetworkList {
+	if in == nil {
+		return nil
+	}
+	out := new(CaminoNetworkList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *CaminoNetworkList) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
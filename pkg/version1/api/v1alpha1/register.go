@@ -0,0 +1,41 @@
+/*
+ * register.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+// Package v1alpha1 contains the CaminoNetwork custom resource reconciled by 'camktncr operator'
+package v1alpha1
+
+import (
+	_ "embed"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/scheme"
+	"sigs.k8s.io/yaml"
+)
+
+var GroupVersion = schema.GroupVersion{Group: "camino.chain4travel.com", Version: "v1alpha1"}
+
+var (
+	SchemeBuilder = &scheme.Builder{GroupVersion: GroupVersion}
+	AddToScheme   = SchemeBuilder.AddToScheme
+)
+
+func init() {
+	SchemeBuilder.Register(&CaminoNetwork{}, &CaminoNetworkList{})
+}
+
+//go:embed crd.yaml
+var crdYaml []byte
+
+// CustomResourceDefinition returns the crd of CaminoNetwork
+func CustomResourceDefinition() (*apiextensionsv1.CustomResourceDefinition, error) {
+	var crd apiextensionsv1.CustomResourceDefinition
+	err := yaml.UnmarshalStrict(crdYaml, &crd)
+	if err != nil {
+		return nil, err
+	}
+	return &crd, nil
+}
@@ -0,0 +1,118 @@
+/*
+ * types.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package v1alpha1
+
+import (
+	"chain4travel.com/camktncr/pkg/version1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	PHASE_PENDING      = "Pending"
+	PHASE_PROVISIONING = "Provisioning"
+	PHASE_REGISTERING  = "RegisteringValidators"
+	PHASE_READY        = "Ready"
+	PHASE_FAILED       = "Failed"
+	PHASE_DELETING     = "Deleting"
+)
+
+type CaminoNetworkResources struct {
+	Validator corev1.ResourceList `json:"validator,omitempty"`
+	Api       corev1.ResourceList `json:"api,omitempty"`
+	Archive   corev1.ResourceList `json:"archive,omitempty"`
+}
+
+type CaminoNetworkIngress struct {
+	// Domain the api nodes are published under as <namespace>.<domain>
+	Domain string `json:"domain,omitempty"`
+	// TLSSecretName is copied from the default namespace
+	TLSSecretName string `json:"tlsSecretName,omitempty"`
+	NodeRoutes    bool   `json:"nodeRoutes,omitempty"`
+	// Archive publishes the archive nodes under /archive
+	Archive     bool              `json:"archive,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type CaminoNetworkMonitoring struct {
+	Enabled    bool `json:"enabled,omitempty"`
+	Dashboards bool `json:"dashboards,omitempty"`
+	Alerts     bool `json:"alerts,omitempty"`
+}
+
+type CaminoNetworkPolicies struct {
+	// Disabled does not isolate the network, for clusters without a policy enforcing cni
+	Disabled bool `json:"disabled,omitempty"`
+	// IngressNamespaces may access the http api, defaults to ingress-nginx
+	IngressNamespaces []string `json:"ingressNamespaces,omitempty"`
+	// MonitoringNamespaces may access the http api, defaults to monitoring
+	MonitoringNamespaces []string `json:"monitoringNamespaces,omitempty"`
+	// Allow contains additional CIDRs or namespace names that may access the http api
+	Allow []string `json:"allow,omitempty"`
+}
+
+type CaminoNetworkNodeConfig struct {
+	// Flags are camino-node flags without the leading --
+	Flags map[string]string `json:"flags,omitempty"`
+	// ChainConfigs maps chain aliases, e.g. C, to the json of their config
+	ChainConfigs map[string]string `json:"chainConfigs,omitempty"`
+}
+
+type CaminoNetworkNodeConfigs struct {
+	Validator CaminoNetworkNodeConfig `json:"validator,omitempty"`
+	Api       CaminoNetworkNodeConfig `json:"api,omitempty"`
+	Archive   CaminoNetworkNodeConfig `json:"archive,omitempty"`
+}
+
+type CaminoNetworkSpec struct {
+	Image string `json:"image"`
+	// ImageOverrides run single roles or ordinal ranges of a role with another image
+	ImageOverrides []version1.K8sImageOverride `json:"imageOverrides,omitempty"`
+	// Validators is the number of validators including the root node
+	Validators int32 `json:"validators"`
+	ApiNodes   int32 `json:"apiNodes"`
+	// ArchiveNodes are api nodes that keep the full history of the C-chain
+	ArchiveNodes int32 `json:"archiveNodes,omitempty"`
+	// NetworkSecret names a secret in the namespace of the resource that contains
+	// the output of 'camktncr generate' under network.json
+	NetworkSecret string `json:"networkSecret"`
+	// PullSecretName is copied from the default namespace
+	PullSecretName string                   `json:"pullSecretName,omitempty"`
+	Resources      CaminoNetworkResources   `json:"resources,omitempty"`
+	NodeConfig     CaminoNetworkNodeConfigs `json:"nodeConfig,omitempty"`
+	Ingress        CaminoNetworkIngress     `json:"ingress,omitempty"`
+	Monitoring     CaminoNetworkMonitoring  `json:"monitoring,omitempty"`
+	// NetworkPolicies isolate the network like 'camktncr k8s create' does
+	NetworkPolicies CaminoNetworkPolicies `json:"networkPolicies,omitempty"`
+}
+
+type CaminoNetworkStatus struct {
+	Phase              string            `json:"phase,omitempty"`
+	Message            string            `json:"message,omitempty"`
+	ObservedGeneration int64             `json:"observedGeneration,omitempty"`
+	Endpoints          map[string]string `json:"endpoints,omitempty"`
+	// RegisteredValidators counts the validators that were added after the genesis
+	RegisteredValidators int32 `json:"registeredValidators,omitempty"`
+	ValidatorsToRegister int32 `json:"validatorsToRegister,omitempty"`
+	// NodeImages maps the nodes, e.g. validator-3, to the image they run with
+	NodeImages map[string]string `json:"nodeImages,omitempty"`
+}
+
+// CaminoNetwork is a network managed by 'camktncr operator'
+type CaminoNetwork struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CaminoNetworkSpec   `json:"spec,omitempty"`
+	Status CaminoNetworkStatus `json:"status,omitempty"`
+}
+
+type CaminoNetworkList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CaminoNetwork `json:"items"`
+}
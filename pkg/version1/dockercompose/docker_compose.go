@@ -115,9 +115,9 @@ func writeOutNodeConfig(nodeID string, index uint64, bootstrapNodeId string, boo
 		ApiAdminEnabled: true,
 		LogDisplayLevel: "TRACE",
 		LogLevel:        "DEBUG",
-		NetworkID:       54321,
-		BootstrapIPs:    bootstrapIps,
-		BootstrapIDs:    bootstrapIds,
+		NetworkID:       uint64(genesisConfig.NetworkID),
+		BootstrapIPs:    &bootstrapIps,
+		BootstrapIDs:    &bootstrapIds,
 	}
 	configJson, err := json.MarshalIndent(config, "", "\t")
 	if err != nil {
@@ -0,0 +1,114 @@
+/*
+ * encryption.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package version1
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const ENCRYPTION_VERSION = 1
+
+// scrypt parameters recommended for interactive logins
+const (
+	SCRYPT_N       = 1 << 15
+	SCRYPT_R       = 8
+	SCRYPT_P       = 1
+	SCRYPT_KEY_LEN = 32
+	SCRYPT_SALT    = 16
+)
+
+var ErrWrongPassphrase = errors.New("could not decrypt network, wrong passphrase")
+
+// encryptedNetwork is the serialized form of a network encrypted with aes-gcm
+// and a key derived from a passphrase
+type encryptedNetwork struct {
+	Version    int
+	Salt       []byte
+	Nonce      []byte
+	Ciphertext []byte
+}
+
+func networkCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("passphrase must not be empty")
+	}
+	key, err := scrypt.Key([]byte(passphrase), salt, SCRYPT_N, SCRYPT_R, SCRYPT_P, SCRYPT_KEY_LEN)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptNetwork serializes the network including all staker keys and encrypts it with passphrase
+func EncryptNetwork(network *Network, passphrase string) ([]byte, error) {
+	plaintext, err := json.Marshal(network)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, SCRYPT_SALT)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	gcm, err := networkCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(encryptedNetwork{
+		Version:    ENCRYPTION_VERSION,
+		Salt:       salt,
+		Nonce:      nonce,
+		Ciphertext: gcm.Seal(nil, nonce, plaintext, nil),
+	})
+}
+
+// DecryptNetwork reverses EncryptNetwork
+func DecryptNetwork(data []byte, passphrase string) (*Network, error) {
+	var encrypted encryptedNetwork
+	err := json.Unmarshal(data, &encrypted)
+	if err != nil {
+		return nil, err
+	}
+	if encrypted.Version != ENCRYPTION_VERSION {
+		return nil, fmt.Errorf("unsupported network encryption version %d", encrypted.Version)
+	}
+
+	gcm, err := networkCipher(passphrase, encrypted.Salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(encrypted.Nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce size %d", len(encrypted.Nonce))
+	}
+	plaintext, err := gcm.Open(nil, encrypted.Nonce, encrypted.Ciphertext, nil)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	var network Network
+	err = json.Unmarshal(plaintext, &network)
+	if err != nil {
+		return nil, err
+	}
+	return &network, nil
+}
@@ -0,0 +1,69 @@
+/*
+ * discovery.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+)
+
+var serviceMonitorResource = schema.GroupVersionResource{Group: "monitoring.coreos.com", Version: "v1", Resource: "servicemonitors"}
+var prometheusRuleResource = schema.GroupVersionResource{Group: "monitoring.coreos.com", Version: "v1", Resource: "prometheusrules"}
+var externalSecretResource = schema.GroupVersionResource{Group: "external-secrets.io", Version: "v1beta1", Resource: "externalsecrets"}
+
+// ClusterCapabilities records which optional crds are installed in the cluster
+type ClusterCapabilities struct {
+	ServiceMonitors bool
+	PrometheusRules bool
+	VolumeSnapshots bool
+	ExternalSecrets bool
+}
+
+// DiscoverCapabilities asks the api server which of the optional crds the tool uses are served
+func DiscoverCapabilities(restClient *rest.Config) (ClusterCapabilities, error) {
+	disc, err := discovery.NewDiscoveryClientForConfig(restClient)
+	if err != nil {
+		return ClusterCapabilities{}, err
+	}
+
+	var caps ClusterCapabilities
+	caps.ServiceMonitors, err = servesResource(disc, serviceMonitorResource)
+	if err != nil {
+		return caps, err
+	}
+	caps.PrometheusRules, err = servesResource(disc, prometheusRuleResource)
+	if err != nil {
+		return caps, err
+	}
+	caps.VolumeSnapshots, err = servesResource(disc, volumeSnapshotResource)
+	if err != nil {
+		return caps, err
+	}
+	caps.ExternalSecrets, err = servesResource(disc, externalSecretResource)
+	if err != nil {
+		return caps, err
+	}
+	return caps, nil
+}
+
+func servesResource(disc discovery.DiscoveryInterface, gvr schema.GroupVersionResource) (bool, error) {
+	resources, err := disc.ServerResourcesForGroupVersion(gvr.GroupVersion().String())
+	if k8sErrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, r := range resources.APIResources {
+		if r.Name == gvr.Resource {
+			return true, nil
+		}
+	}
+	return false, nil
+}
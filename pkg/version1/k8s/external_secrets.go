@@ -0,0 +1,132 @@
+/*
+ * external_secrets.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"time"
+
+	"chain4travel.com/camktncr/pkg/version1"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const EXTERNAL_SECRET_REFRESH_INTERVAL = "1h"
+const EXTERNAL_SECRET_SYNC_TIMEOUT = 5 * time.Minute
+
+func buildExternalSecret(k8sConfig version1.K8sConfig, name string) *unstructured.Unstructured {
+	labels := make(map[string]interface{}, len(k8sConfig.Labels))
+	for k, v := range k8sConfig.Labels {
+		labels[k] = v
+	}
+
+	kind := k8sConfig.StakerSecrets.ExternalSecretStoreKind
+	if kind == "" {
+		kind = version1.EXTERNAL_SECRET_STORE
+	}
+
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "external-secrets.io/v1beta1",
+		"kind":       "ExternalSecret",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": k8sConfig.Namespace,
+			"labels":    labels,
+		},
+		"spec": map[string]interface{}{
+			"refreshInterval": EXTERNAL_SECRET_REFRESH_INTERVAL,
+			"secretStoreRef": map[string]interface{}{
+				"name": k8sConfig.StakerSecrets.ExternalSecretStore,
+				"kind": kind,
+			},
+			// the synced secret is labeled like the ones written directly so destroy and snapshots find it
+			"target": map[string]interface{}{
+				"name":           name,
+				"creationPolicy": "Owner",
+				"template": map[string]interface{}{
+					"type": string(corev1.SecretTypeTLS),
+					"metadata": map[string]interface{}{
+						"labels": labels,
+					},
+				},
+			},
+			"dataFrom": []interface{}{
+				map[string]interface{}{
+					"extract": map[string]interface{}{
+						"key": path.Join(k8sConfig.StakerSecrets.Path, name),
+					},
+				},
+			},
+		},
+	}}
+}
+
+// createExternalSecrets lets the external secrets operator sync the staker secrets from the store
+// and waits until all of them exist, the nodes cannot start without them
+func createExternalSecrets(ctx context.Context, restClient *rest.Config, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, names []string) error {
+	dynClient, err := dynamic.NewForConfig(restClient)
+	if err != nil {
+		return err
+	}
+	client := dynClient.Resource(externalSecretResource).Namespace(k8sConfig.Namespace)
+
+	for _, name := range names {
+		_, err := client.Apply(ctx, name, buildExternalSecret(k8sConfig, name), metav1.ApplyOptions{
+			Force:        true,
+			FieldManager: FIELD_MANAGER_STRING,
+		})
+		if err != nil {
+			return fmt.Errorf("could not create external secret %s: %w", name, err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, EXTERNAL_SECRET_SYNC_TIMEOUT)
+	defer cancel()
+
+	for _, name := range names {
+		for {
+			_, err := clientset.CoreV1().Secrets(k8sConfig.Namespace).Get(ctx, name, metav1.GetOptions{})
+			if err == nil {
+				break
+			}
+			if !k8sErrors.IsNotFound(err) {
+				return err
+			}
+
+			log.Printf("waiting for external secret %s to be synced\n", name)
+
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("external secret %s was not synced from store %s: %w", name, k8sConfig.StakerSecrets.ExternalSecretStore, ctx.Err())
+			case <-time.After(DEFAULT_TIMEOUT):
+			}
+		}
+	}
+	return nil
+}
+
+func deleteExternalSecrets(ctx context.Context, restClient *rest.Config, namespace string, selector string) error {
+	dynClient, err := dynamic.NewForConfig(restClient)
+	if err != nil {
+		return err
+	}
+	err = dynClient.Resource(externalSecretResource).Namespace(namespace).DeleteCollection(ctx, *metav1.NewDeleteOptions(0), metav1.ListOptions{
+		LabelSelector: selector,
+	})
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+/*
+ * images.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// TEMPLATE_HASH_ANNOTATION is the hash of the pod template a pod of a split stateful set was created from
+const TEMPLATE_HASH_ANNOTATION = "camktncr/template-hash"
+
+// imageRevisions splits the pods of a stateful set into the ordinals below partition running the
+// lower image and the ones from partition on running the upper image. A stateful set only keeps a
+// current and an update revision, so the image of a role may change only once between its ordinals.
+// partition equals the number of replicas if all pods run the same image
+func imageRevisions(options stateFullSetOptions) (string, string, int32, error) {
+	lower := options.Image(0)
+	upper := lower
+	partition := options.Replicas
+
+	for i := int32(1); i < options.Replicas; i++ {
+		image := options.Image(i)
+		if partition == options.Replicas {
+			if image != lower {
+				upper = image
+				partition = i
+			}
+			continue
+		}
+		if image != upper {
+			return "", "", 0, fmt.Errorf("%s can only run two images split at one ordinal, but %s-%d runs %s after %s-%d switched to %s", options.Type, options.Type, i, image, options.Type, partition, upper)
+		}
+	}
+
+	return lower, upper, partition, nil
+}
+
+func partitionedUpdate(partition int32) appsv1.StatefulSetUpdateStrategy {
+	return appsv1.StatefulSetUpdateStrategy{
+		Type: appsv1.RollingUpdateStatefulSetStrategyType,
+		RollingUpdate: &appsv1.RollingUpdateStatefulSetStrategy{
+			Partition: &partition,
+		},
+	}
+}
+
+func setNodeImage(sts *appsv1.StatefulSet, image string) {
+	for i := range sts.Spec.Template.Spec.Containers {
+		if sts.Spec.Template.Spec.Containers[i].Name == NODE_CONTAINER_NAME {
+			sts.Spec.Template.Spec.Containers[i].Image = image
+		}
+	}
+}
+
+// expectedUpdatedReplicas is the number of pods a rollout of the stateful set updates,
+// pods below the partition keep the current revision
+func expectedUpdatedReplicas(sts *appsv1.StatefulSet, replicas int32) int32 {
+	if sts.Spec.UpdateStrategy.RollingUpdate == nil || sts.Spec.UpdateStrategy.RollingUpdate.Partition == nil {
+		return replicas
+	}
+	partition := *sts.Spec.UpdateStrategy.RollingUpdate.Partition
+	if partition > replicas {
+		return 0
+	}
+	return replicas - partition
+}
+
+// setTemplateHash records the hash of the pod template in the template, pods keep the hash of the
+// template they were created from. Split stateful sets need it to tell which template the pods
+// below the partition run, their revision is not updated with the template
+func setTemplateHash(sts *appsv1.StatefulSet) {
+	delete(sts.Spec.Template.Annotations, TEMPLATE_HASH_ANNOTATION)
+	// maps are marshalled with sorted keys
+	raw, _ := json.Marshal(sts.Spec.Template)
+	sum := sha256.Sum256(raw)
+
+	annotations := make(map[string]string, len(sts.Spec.Template.Annotations)+1)
+	for k, v := range sts.Spec.Template.Annotations {
+		annotations[k] = v
+	}
+	annotations[TEMPLATE_HASH_ANNOTATION] = hex.EncodeToString(sum[:8])
+	sts.Spec.Template.Annotations = annotations
+}
+
+func nodeImageOf(pod *corev1.Pod) string {
+	for _, c := range pod.Spec.Containers {
+		if c.Name == NODE_CONTAINER_NAME {
+			return c.Image
+		}
+	}
+	return ""
+}
+
+// lowerTemplateRolledOut reports if the pods below partition run the pod template of sts. Pods below
+// the partition are only ever recreated with the current revision of the stateful set, which does not
+// change until a rollout updated all pods. Pods without a template hash were created before the set
+// was split and do not run the template either
+func lowerTemplateRolledOut(ctx context.Context, clientset *kubernetes.Clientset, options stateFullSetOptions, sts appsv1.StatefulSet, partition int32) (bool, error) {
+	for i := int32(0); i < partition; i++ {
+		pod, err := clientset.CoreV1().Pods(options.Namespace).Get(ctx, options.PodName(i), metav1.GetOptions{})
+		if k8sErrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		if pod.Annotations[TEMPLATE_HASH_ANNOTATION] != sts.Spec.Template.Annotations[TEMPLATE_HASH_ANNOTATION] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// checkNoRollback fails if rolling out the lower image to all pods would move a pod from another
+// image to it, e.g. downgrading a pod of the upper image and with it the database of the node
+func checkNoRollback(ctx context.Context, clientset *kubernetes.Clientset, options stateFullSetOptions, lowerImage string, upperImage string, partition int32) error {
+	for i := int32(0); i < options.Replicas; i++ {
+		pod, err := clientset.CoreV1().Pods(options.Namespace).Get(ctx, options.PodName(i), metav1.GetOptions{})
+		if k8sErrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		image := nodeImageOf(pod)
+		if (i >= partition && image != lowerImage) || (i < partition && image == upperImage && upperImage != lowerImage) {
+			return fmt.Errorf("the pods of %s below ordinal %d have to be updated, but a stateful set can only do that by rolling out all pods, which would move %s from %s to %s. Run all %s nodes with one image first", options.Name(), partition, pod.Name, image, lowerImage, options.Type)
+		}
+	}
+	return nil
+}
+
+// waitForCurrentRevision blocks until the stateful set controller recorded the current revision,
+// otherwise the following update would become the revision of all pods
+func waitForCurrentRevision(ctx context.Context, clientset *kubernetes.Clientset, options stateFullSetOptions) error {
+	for {
+		sts, err := clientset.AppsV1().StatefulSets(options.Namespace).Get(ctx, options.Name(), metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if sts.Status.ObservedGeneration >= sts.Generation && sts.Status.CurrentRevision != "" {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s did not record its current revision: %w", options.Name(), ctx.Err())
+		case <-time.After(DEFAULT_TIMEOUT):
+		}
+	}
+}
+
+// rolloutUpperImage updates the pods from partition on to the upper image. A stateful set that was
+// just created with the pods below partition only is scaled up to all replicas of sts with it
+func rolloutUpperImage(ctx context.Context, clientset *kubernetes.Clientset, options stateFullSetOptions, sts appsv1.StatefulSet, image string, partition int32) error {
+	err := waitForCurrentRevision(ctx, clientset, options)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("running %s from ordinal %d on with %s\n", options.Type, partition, image)
+
+	setNodeImage(&sts, image)
+	setTemplateHash(&sts)
+	sts.Spec.UpdateStrategy = partitionedUpdate(partition)
+	_, err = clientset.AppsV1().StatefulSets(options.Namespace).Update(ctx, &sts, metav1.UpdateOptions{
+		FieldManager: FIELD_MANAGER_STRING,
+	})
+	return err
+}
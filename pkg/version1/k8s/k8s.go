@@ -21,24 +21,25 @@ import (
 	promVersioned "github.com/prometheus-operator/prometheus-operator/pkg/client/versioned"
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
-	rbacv1 "k8s.io/api/rbac/v1"
 	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	applyv1 "k8s.io/client-go/applyconfigurations/core/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
-
-	applymetav1 "k8s.io/client-go/applyconfigurations/meta/v1"
 )
 
 const FIELD_MANAGER_STRING = "camktncr-test-net-creator"
 const DEFAULT_TIMEOUT = 2 * time.Second
 
-func CreateNamespace(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig) error {
+// CreateNamespace creates the namespace of the network stamped with ownership markers. Existing namespaces
+// are only reused if they are owned by camktncr for the same network, unless force is set
+func CreateNamespace(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, force bool) error {
+	labels, annotations := ownershipMarkers(k8sConfig)
 	namespace := corev1.Namespace{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: k8sConfig.Namespace,
+			Name:        k8sConfig.Namespace,
+			Labels:      labels,
+			Annotations: annotations,
 		},
 	}
 
@@ -46,7 +47,11 @@ func CreateNamespace(ctx context.Context, clientset *kubernetes.Clientset, k8sCo
 	if err != nil && !k8sErrors.IsAlreadyExists(err) {
 		return err
 	}
-	return nil
+	if err == nil || force {
+		return nil
+	}
+
+	return CheckNamespaceOwnership(ctx, clientset, k8sConfig)
 }
 
 func CreateNetworkConfigMap(ctx context.Context, clientset *kubernetes.Clientset, genesisConfig genesis.UnparsedConfig, k8sConfig version1.K8sConfig) error {
@@ -123,48 +128,32 @@ func CreateScriptsConfigMap(ctx context.Context, clientset *kubernetes.Clientset
 	return err
 }
 
-func CreateStakerSecrets(ctx context.Context, clientset *kubernetes.Clientset, stakers []version1.Staker, k8sConfig version1.K8sConfig) error {
-
-	secretType := corev1.SecretTypeTLS
-	kind := "Secret"
-	version := "v1"
-	typeMeta := &applymetav1.TypeMetaApplyConfiguration{
-		Kind:       &kind,
-		APIVersion: &version,
+// CreateStakerSecrets writes the certificates and keys of the stakers with the provider. With an
+// external secret store configured the secrets in the namespace are synced from it
+func CreateStakerSecrets(ctx context.Context, restClient *rest.Config, clientset *kubernetes.Clientset, provider SecretProvider, stakers []version1.Staker, k8sConfig version1.K8sConfig) error {
+	stakerData := make([]map[string][]byte, len(stakers))
+	for i, s := range stakers {
+		stakerData[i] = stakerSecretData(s, k8sConfig.StakerSecrets.ExcludePrivateKeys)
 	}
+	return writeStakerSecrets(ctx, restClient, clientset, provider, stakerData, k8sConfig)
+}
 
-	for i, s := range stakers {
+// writeStakerSecrets writes the secret of every staker as <prefix>-<index>
+func writeStakerSecrets(ctx context.Context, restClient *rest.Config, clientset *kubernetes.Clientset, provider SecretProvider, stakerData []map[string][]byte, k8sConfig version1.K8sConfig) error {
+	names := make([]string, 0, len(stakerData))
+	for i, data := range stakerData {
 		name := fmt.Sprintf("%s-%d", k8sConfig.K8sPrefix, i)
-		secret := &applyv1.SecretApplyConfiguration{
-			TypeMetaApplyConfiguration: *typeMeta,
-			ObjectMetaApplyConfiguration: &applymetav1.ObjectMetaApplyConfiguration{
-				Name:      &name,
-				Namespace: &k8sConfig.Namespace,
-				Labels:    k8sConfig.Labels,
-			},
-			Data: map[string][]byte{
-				string(corev1.TLSCertKey):       s.CertBytes,
-				string(corev1.TLSPrivateKeyKey): s.KeyBytes,
-			},
-			StringData: map[string]string{
-				"Node-ID":       s.NodeID.String(),
-				"PublicAddress": s.PublicAddress,
-				"PrivateKey":    s.PrivateKey,
-			},
-
-			Type: &secretType,
-		}
-
-		_, err := clientset.CoreV1().Secrets(k8sConfig.Namespace).Apply(ctx, secret, metav1.ApplyOptions{
-			Force:        true,
-			FieldManager: FIELD_MANAGER_STRING,
-		})
+		err := provider.WriteSecret(ctx, name, data)
 		if err != nil {
-			return err
+			return fmt.Errorf("could not write staker secret %s: %w", name, err)
 		}
+		names = append(names, name)
 	}
 
-	return nil
+	if k8sConfig.StakerSecrets.ExternalSecretStore == "" {
+		return nil
+	}
+	return createExternalSecrets(ctx, restClient, clientset, k8sConfig, names)
 }
 
 func CopySecretFromDefaultNamespace(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, secretName string) error {
@@ -184,155 +173,70 @@ func CopySecretFromDefaultNamespace(ctx context.Context, clientset *kubernetes.C
 
 }
 
-func CreateRBAC(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig) error {
-
-	saName := k8sConfig.PrefixWith("init-container")
-
-	sa := corev1.ServiceAccount{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      saName,
-			Namespace: k8sConfig.Namespace,
-		},
-	}
-
-	saClient := clientset.CoreV1().ServiceAccounts(k8sConfig.Namespace)
-
-	_, foundErr := saClient.Get(ctx, saName, metav1.GetOptions{})
-	if foundErr == nil {
-		_, err := saClient.Update(ctx, &sa, metav1.UpdateOptions{
-			FieldManager: FIELD_MANAGER_STRING,
-		})
-		if err != nil {
-			return err
-		}
-	} else {
-		_, err := saClient.Create(ctx, &sa, metav1.CreateOptions{
-			FieldManager: FIELD_MANAGER_STRING,
-		})
-		if err != nil {
-			return err
-		}
-	}
-
-	roleName := k8sConfig.PrefixWith("secret-reader")
-	role := rbacv1.Role{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      roleName,
-			Namespace: k8sConfig.Namespace,
-		},
-		Rules: []rbacv1.PolicyRule{
-			{
-				APIGroups: []string{""},
-				Resources: []string{"secrets"},
-				Verbs:     []string{"get", "watch", "list"},
-			},
-		},
-	}
-
-	roleClient := clientset.RbacV1().Roles(k8sConfig.Namespace)
-
-	_, foundErr = roleClient.Get(ctx, roleName, metav1.GetOptions{})
-	if foundErr == nil {
-		_, err := roleClient.Update(ctx, &role, metav1.UpdateOptions{
-			FieldManager: FIELD_MANAGER_STRING,
-		})
-		if err != nil {
-			return err
-		}
-	} else {
-
-		_, err := roleClient.Create(ctx, &role, metav1.CreateOptions{
-			FieldManager: FIELD_MANAGER_STRING,
-		})
-		if err != nil {
-			return err
-		}
-	}
-
-	rbName := k8sConfig.PrefixWith("read-pods")
-	rb := rbacv1.RoleBinding{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      rbName,
-			Namespace: k8sConfig.Namespace,
-		},
-		Subjects: []rbacv1.Subject{
-			{
-				Kind: "ServiceAccount",
-				Name: saName,
-			},
-		},
-
-		RoleRef: rbacv1.RoleRef{
-			Kind:     "Role",
-			APIGroup: "rbac.authorization.k8s.io",
-			Name:     roleName,
-		},
-	}
-
-	rbClient := clientset.RbacV1().RoleBindings(k8sConfig.Namespace)
-
-	_, foundErr = rbClient.Get(ctx, rbName, metav1.GetOptions{})
-	if foundErr == nil {
-		_, err := rbClient.Update(ctx, &rb, metav1.UpdateOptions{
-			FieldManager: FIELD_MANAGER_STRING,
-		})
-		if err != nil {
-			return err
-		}
-	} else {
-
-		_, err := rbClient.Create(ctx, &rb, metav1.CreateOptions{
-			FieldManager: FIELD_MANAGER_STRING,
-		})
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
-
+// nodeOptions configures the stateful sets of role (root, validator, api or archive)
+func nodeOptions(k8sConfig version1.K8sConfig, role string, numberOfNodes int32) stateFullSetOptions {
+	options := stateFullSetOptions{
+		K8sConfig: k8sConfig,
+		Type:      role,
+		Replicas:  numberOfNodes,
+	}
+
+	switch role {
+	case "root", "validator":
+		options.IsValidator = true
+		options.IsRoot = role == "root"
+		options.Requests = k8sConfig.Resources.Validator
+		options.Limits = k8sConfig.Resources.ValidatorLimits
+		options.Scheduling = k8sConfig.Resources.ValidatorScheduling
+		options.DataVolume = k8sConfig.Storage.Validator
+		options.Probe = k8sConfig.Probes.Validator
+	case "archive":
+		options.Requests = k8sConfig.Resources.Archive
+		options.Limits = k8sConfig.Resources.ArchiveLimits
+		options.Scheduling = k8sConfig.Resources.ArchiveScheduling
+		options.DataVolume = k8sConfig.Storage.Archive
+		options.Probe = k8sConfig.Probes.Archive
+	default:
+		options.Requests = k8sConfig.Resources.Api
+		options.Limits = k8sConfig.Resources.ApiLimits
+		options.Scheduling = k8sConfig.Resources.ApiScheduling
+		options.DataVolume = k8sConfig.Storage.Api
+		options.Probe = k8sConfig.Probes.Api
+	}
+	return options
 }
 
 func CreateApiNodes(ctx context.Context, restClient *rest.Config, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, numberOfNodes int32) error {
+	return createStatefulSetWithOptions(ctx, restClient, clientset, nodeOptions(k8sConfig, "api", numberOfNodes))
+}
 
-	options := stateFullSetOptions{
-		K8sConfig:   k8sConfig,
-		Type:        "api",
-		IsValidator: false,
-		IsRoot:      false,
-		Replicas:    numberOfNodes,
-		Requests:    k8sConfig.Resources.Api,
-	}
-
-	return createStatefulSetWithOptions(ctx, restClient, clientset, options)
+// CreateArchiveNodes runs api nodes that keep the full history of the C-chain, see nodeConfigFor
+func CreateArchiveNodes(ctx context.Context, restClient *rest.Config, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, numberOfNodes int32) error {
+	return createStatefulSetWithOptions(ctx, restClient, clientset, nodeOptions(k8sConfig, "archive", numberOfNodes))
 }
 
 func CreateRootNode(ctx context.Context, restClient *rest.Config, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig) error {
-
-	options := stateFullSetOptions{
-		K8sConfig:   k8sConfig,
-		Type:        "root",
-		IsValidator: true,
-		IsRoot:      true,
-		Replicas:    1,
-		Requests:    k8sConfig.Resources.Validator,
-	}
-
-	return createStatefulSetWithOptions(ctx, restClient, clientset, options)
+	return createStatefulSetWithOptions(ctx, restClient, clientset, nodeOptions(k8sConfig, "root", 1))
 }
 
 func CreateValidators(ctx context.Context, restClient *rest.Config, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, numberOfNodes int32) error {
+	return createStatefulSetWithOptions(ctx, restClient, clientset, nodeOptions(k8sConfig, "validator", numberOfNodes))
+}
 
-	options := stateFullSetOptions{
-		K8sConfig:   k8sConfig,
-		Type:        "validator",
-		IsValidator: true,
-		IsRoot:      false,
-		Replicas:    numberOfNodes,
-		Requests:    k8sConfig.Resources.Validator,
+// ApplyNodes creates or updates the stateful sets of role like the Create functions, but does not
+// wait for its pods. It reports if all pods are updated and ready and fails if a pod will not start
+func ApplyNodes(ctx context.Context, restClient *rest.Config, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, role string, numberOfNodes int32) (bool, error) {
+	options := nodeOptions(k8sConfig, role, numberOfNodes)
+	_, err := applyRole(ctx, restClient, clientset, options)
+	if err != nil {
+		return false, err
 	}
+	return checkRole(ctx, clientset, options)
+}
 
-	return createStatefulSetWithOptions(ctx, restClient, clientset, options)
+// IngressURL is the public url of path on the ingress of the network
+func IngressURL(k8sConfig version1.K8sConfig, path string) string {
+	return fmt.Sprintf("https://%s.%s%s", k8sConfig.Namespace, k8sConfig.Domain, path)
 }
 
 func CreateIngress(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, annotations map[string]string) error {
@@ -442,6 +346,22 @@ func CreateIngress(ctx context.Context, clientset *kubernetes.Clientset, k8sConf
 		},
 	}
 
+	if k8sConfig.ArchiveIngress {
+		rule := static_ingress.Spec.Rules[0].HTTP
+		rule.Paths = append(rule.Paths, networkingv1.HTTPIngressPath{
+			Path:     "/archive(/|$)(.*)",
+			PathType: &pathType,
+			Backend: networkingv1.IngressBackend{
+				Service: &networkingv1.IngressServiceBackend{
+					Name: k8sConfig.PrefixWith("archive"),
+					Port: networkingv1.ServiceBackendPort{
+						Name: "rpc",
+					},
+				},
+			},
+		})
+	}
+
 	ingClient := clientset.NetworkingV1().Ingresses(k8sConfig.Namespace)
 
 	for _, ing := range []networkingv1.Ingress{static_ingress, ingress} {
@@ -466,6 +386,106 @@ func CreateIngress(ctx context.Context, clientset *kubernetes.Clientset, k8sConf
 
 }
 
+// nodeRoutePath matches everything below /node/<name>/ and hands the remainder to the node,
+// admin endpoints are left out unless explicitly requested
+func nodeRoutePath(name string, allowAdmin bool) string {
+	if allowAdmin {
+		return fmt.Sprintf("/node/%s(/|$)(.*)", name)
+	}
+	return fmt.Sprintf("/node/%s(/|$)((?!ext/admin).*)", name)
+}
+
+// CreateNodeIngress publishes every node under /node/<type>-<ordinal>/ and validators additionally
+// under /node/<NodeID>/. stakers are expected in the order they are assigned to the root node and validators
+func CreateNodeIngress(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, stakers []version1.Staker, numApiNodes int32, numArchiveNodes int32, annotations map[string]string) error {
+	pathType := networkingv1.PathTypePrefix
+	node_annotations := make(map[string]string)
+	for k, v := range annotations {
+		node_annotations[k] = v
+	}
+	node_annotations["nginx.ingress.kubernetes.io/rewrite-target"] = "/$2"
+	node_annotations["nginx.ingress.kubernetes.io/use-regex"] = "true"
+
+	paths := make([]networkingv1.HTTPIngressPath, 0)
+	addPaths := func(options stateFullSetOptions, ordinal int32, nodeID string) {
+		names := []string{fmt.Sprintf("%s-%d", options.Type, ordinal)}
+		if nodeID != "" {
+			names = append(names, nodeID)
+		}
+		for _, name := range names {
+			paths = append(paths, networkingv1.HTTPIngressPath{
+				Path:     nodeRoutePath(name, k8sConfig.NodeRoutesAdmin),
+				PathType: &pathType,
+				Backend: networkingv1.IngressBackend{
+					Service: &networkingv1.IngressServiceBackend{
+						Name: options.PodName(ordinal),
+						Port: networkingv1.ServiceBackendPort{
+							Name: "rpc",
+						},
+					},
+				},
+			})
+		}
+	}
+
+	if len(stakers) > 0 {
+		addPaths(stateFullSetOptions{K8sConfig: k8sConfig, Type: "root"}, 0, stakers[0].NodeID.String())
+		for i, s := range stakers[1:] {
+			addPaths(stateFullSetOptions{K8sConfig: k8sConfig, Type: "validator"}, int32(i), s.NodeID.String())
+		}
+	}
+	for i := int32(0); i < numApiNodes; i++ {
+		addPaths(stateFullSetOptions{K8sConfig: k8sConfig, Type: "api"}, i, "")
+	}
+	for i := int32(0); i < numArchiveNodes; i++ {
+		addPaths(stateFullSetOptions{K8sConfig: k8sConfig, Type: "archive"}, i, "")
+	}
+
+	nginx := "nginx"
+	host := fmt.Sprintf("%s.%s", k8sConfig.Namespace, k8sConfig.Domain)
+	ingress := networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        k8sConfig.PrefixWith("ingress-nodes"),
+			Namespace:   k8sConfig.Namespace,
+			Annotations: node_annotations,
+			Labels:      k8sConfig.Labels,
+		},
+		Spec: networkingv1.IngressSpec{
+			IngressClassName: &nginx,
+			Rules: []networkingv1.IngressRule{
+				{
+					Host: host,
+					IngressRuleValue: networkingv1.IngressRuleValue{
+						HTTP: &networkingv1.HTTPIngressRuleValue{
+							Paths: paths,
+						},
+					},
+				},
+			},
+			TLS: []networkingv1.IngressTLS{
+				{
+					Hosts:      []string{host},
+					SecretName: k8sConfig.PrefixWith("tls-secret"),
+				},
+			},
+		},
+	}
+
+	ingClient := clientset.NetworkingV1().Ingresses(k8sConfig.Namespace)
+
+	_, foundErr := ingClient.Get(ctx, ingress.Name, metav1.GetOptions{})
+	if foundErr == nil {
+		err := ingClient.Delete(ctx, ingress.Name, *metav1.NewDeleteOptions(0))
+		if err != nil {
+			return err
+		}
+	}
+	_, err := ingClient.Create(ctx, &ingress, metav1.CreateOptions{
+		FieldManager: FIELD_MANAGER_STRING,
+	})
+	return err
+}
+
 func DeleteCluster(ctx context.Context, restClient *rest.Config, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, keepDisks bool) error {
 	selector, err := metav1.LabelSelectorAsSelector(k8sConfig.Selector())
 	if err != nil {
@@ -481,7 +501,7 @@ func DeleteCluster(ctx context.Context, restClient *rest.Config, clientset *kube
 		return err
 	}
 
-	for _, sts := range []string{"api", "root", "validator"} {
+	for _, sts := range []string{"api", "archive", "root", "validator"} {
 
 		err = clientset.CoreV1().Services(k8sConfig.Namespace).Delete(ctx, k8sConfig.PrefixWith(sts), *metav1.NewDeleteOptions(0))
 		if err != nil && !k8sErrors.IsNotFound(err) {
@@ -489,40 +509,55 @@ func DeleteCluster(ctx context.Context, restClient *rest.Config, clientset *kube
 		}
 	}
 
-	err = clientset.CoreV1().ConfigMaps(k8sConfig.Namespace).DeleteCollection(ctx, *metav1.NewDeleteOptions(0), metav1.ListOptions{
+	// services do not support delete collection
+	services, err := clientset.CoreV1().Services(k8sConfig.Namespace).List(ctx, metav1.ListOptions{
 		LabelSelector: selectorString,
 	})
-	if err != nil && !k8sErrors.IsNotFound(err) {
+	if err != nil {
 		return err
 	}
-	err = clientset.NetworkingV1().Ingresses(k8sConfig.Namespace).DeleteCollection(ctx, *metav1.NewDeleteOptions(0), metav1.ListOptions{
+	for _, svc := range services.Items {
+		err = clientset.CoreV1().Services(k8sConfig.Namespace).Delete(ctx, svc.Name, *metav1.NewDeleteOptions(0))
+		if err != nil && !k8sErrors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	err = clientset.NetworkingV1().NetworkPolicies(k8sConfig.Namespace).DeleteCollection(ctx, *metav1.NewDeleteOptions(0), metav1.ListOptions{
 		LabelSelector: selectorString,
 	})
 	if err != nil && !k8sErrors.IsNotFound(err) {
 		return err
 	}
-	err = clientset.CoreV1().Secrets(k8sConfig.Namespace).DeleteCollection(ctx, *metav1.NewDeleteOptions(0), metav1.ListOptions{
+
+	err = clientset.CoreV1().ConfigMaps(k8sConfig.Namespace).DeleteCollection(ctx, *metav1.NewDeleteOptions(0), metav1.ListOptions{
 		LabelSelector: selectorString,
 	})
 	if err != nil && !k8sErrors.IsNotFound(err) {
 		return err
 	}
-	err = clientset.CoreV1().ServiceAccounts(k8sConfig.Namespace).DeleteCollection(ctx, *metav1.NewDeleteOptions(0), metav1.ListOptions{
+	err = clientset.NetworkingV1().Ingresses(k8sConfig.Namespace).DeleteCollection(ctx, *metav1.NewDeleteOptions(0), metav1.ListOptions{
 		LabelSelector: selectorString,
 	})
 	if err != nil && !k8sErrors.IsNotFound(err) {
 		return err
 	}
-
-	err = clientset.RbacV1().RoleBindings(k8sConfig.Namespace).DeleteCollection(ctx, *metav1.NewDeleteOptions(0), metav1.ListOptions{
+	err = clientset.CoreV1().Secrets(k8sConfig.Namespace).DeleteCollection(ctx, *metav1.NewDeleteOptions(0), metav1.ListOptions{
 		LabelSelector: selectorString,
 	})
 	if err != nil && !k8sErrors.IsNotFound(err) {
 		return err
 	}
-	err = clientset.RbacV1().Roles(k8sConfig.Namespace).DeleteCollection(ctx, *metav1.NewDeleteOptions(0), metav1.ListOptions{
-		LabelSelector: selectorString,
-	})
+	// networks created by older versions read their certificates with a service account
+	err = clientset.CoreV1().ServiceAccounts(k8sConfig.Namespace).Delete(ctx, k8sConfig.PrefixWith("init-container"), *metav1.NewDeleteOptions(0))
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		return err
+	}
+	err = clientset.RbacV1().RoleBindings(k8sConfig.Namespace).Delete(ctx, k8sConfig.PrefixWith("read-pods"), *metav1.NewDeleteOptions(0))
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		return err
+	}
+	err = clientset.RbacV1().Roles(k8sConfig.Namespace).Delete(ctx, k8sConfig.PrefixWith("secret-reader"), *metav1.NewDeleteOptions(0))
 	if err != nil && !k8sErrors.IsNotFound(err) {
 		return err
 	}
@@ -537,17 +572,49 @@ func DeleteCluster(ctx context.Context, restClient *rest.Config, clientset *kube
 		}
 	}
 
-	promClientSet, err := promVersioned.NewForConfig(restClient)
+	// optional crds are only cleaned up if they are installed, see DiscoverCapabilities
+	caps, err := DiscoverCapabilities(restClient)
 	if err != nil {
 		return err
 	}
 
-	err = promClientSet.MonitoringV1().ServiceMonitors(k8sConfig.Namespace).DeleteCollection(ctx, *metav1.NewDeleteOptions(0), metav1.ListOptions{
-		LabelSelector: selectorString,
-	})
-	if err != nil && !k8sErrors.IsNotFound(err) {
+	if caps.VolumeSnapshots {
+		err = deleteRestoredSnapshots(ctx, restClient, k8sConfig.Namespace, selectorString)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the synced secrets are owned by the external secrets and removed with them
+	if caps.ExternalSecrets {
+		err = deleteExternalSecrets(ctx, restClient, k8sConfig.Namespace, selectorString)
+		if err != nil {
+			return err
+		}
+	}
+
+	promClientSet, err := promVersioned.NewForConfig(restClient)
+	if err != nil {
 		return err
 	}
 
+	if caps.ServiceMonitors {
+		err = promClientSet.MonitoringV1().ServiceMonitors(k8sConfig.Namespace).DeleteCollection(ctx, *metav1.NewDeleteOptions(0), metav1.ListOptions{
+			LabelSelector: selectorString,
+		})
+		if err != nil && !k8sErrors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	if caps.PrometheusRules {
+		err = promClientSet.MonitoringV1().PrometheusRules(k8sConfig.Namespace).DeleteCollection(ctx, *metav1.NewDeleteOptions(0), metav1.ListOptions{
+			LabelSelector: selectorString,
+		})
+		if err != nil && !k8sErrors.IsNotFound(err) {
+			return err
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,237 @@
+/*
+ * lock.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"chain4travel.com/camktncr/pkg/version1"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const LOCK_LEASE_DURATION = 60 * time.Second
+const LOCK_RENEW_INTERVAL = LOCK_LEASE_DURATION / 3
+
+var ErrNetworkLocked = fmt.Errorf("network is locked")
+
+// NetworkLock is a lease in the namespace of the network that is held by a single mutating command.
+// The lease is renewed in the background and expires if the holder dies. If it cannot be renewed
+// in time or another command took it over, Lost is closed and the command has to stop
+type NetworkLock struct {
+	clientset *kubernetes.Clientset
+	namespace string
+	name      string
+	holder    string
+	stop      chan struct{}
+	done      chan struct{}
+	lost      chan struct{}
+	err       error
+}
+
+func lockName(k8sConfig version1.K8sConfig) string {
+	return k8sConfig.PrefixWith("lock")
+}
+
+func lockHolder(operation string) string {
+	return fmt.Sprintf("%s %s pid %d", creator(), operation, os.Getpid())
+}
+
+func leaseExpired(lease *coordinationv1.Lease, now time.Time) bool {
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity == "" || lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	expiry := lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+	return now.After(expiry)
+}
+
+// AcquireNetworkLock takes the lock of the network for the given operation or fails with ErrNetworkLocked
+// if another command holds it. If the namespace does not exist yet there is nothing to protect and a
+// lock without lease is returned
+func AcquireNetworkLock(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, operation string) (*NetworkLock, error) {
+	lock := &NetworkLock{
+		clientset: clientset,
+		namespace: k8sConfig.Namespace,
+		name:      lockName(k8sConfig),
+		holder:    lockHolder(operation),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+		lost:      make(chan struct{}),
+	}
+
+	leaseClient := clientset.CoordinationV1().Leases(lock.namespace)
+	now := metav1.NewMicroTime(time.Now())
+	duration := int32(LOCK_LEASE_DURATION / time.Second)
+
+	existing, err := leaseClient.Get(ctx, lock.name, metav1.GetOptions{})
+	switch {
+	case k8sErrors.IsNotFound(err):
+		lease := &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      lock.name,
+				Namespace: lock.namespace,
+				Labels:    k8sConfig.Labels,
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &lock.holder,
+				LeaseDurationSeconds: &duration,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}
+		_, err = leaseClient.Create(ctx, lease, metav1.CreateOptions{
+			FieldManager: FIELD_MANAGER_STRING,
+		})
+		if k8sErrors.IsNotFound(err) {
+			close(lock.done)
+			return lock, nil
+		}
+		if k8sErrors.IsAlreadyExists(err) {
+			return AcquireNetworkLock(ctx, clientset, k8sConfig, operation)
+		}
+		if err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	default:
+		if !leaseExpired(existing, now.Time) {
+			since := "unknown"
+			if existing.Spec.AcquireTime != nil {
+				since = existing.Spec.AcquireTime.Format(time.RFC3339)
+			}
+			return nil, fmt.Errorf("%w: %s locked by %s since %s", ErrNetworkLocked, k8sConfig.K8sPrefix, *existing.Spec.HolderIdentity, since)
+		}
+
+		// the resource version makes sure only one of several waiting commands takes over
+		existing.Spec.HolderIdentity = &lock.holder
+		existing.Spec.LeaseDurationSeconds = &duration
+		existing.Spec.AcquireTime = &now
+		existing.Spec.RenewTime = &now
+		_, err = leaseClient.Update(ctx, existing, metav1.UpdateOptions{
+			FieldManager: FIELD_MANAGER_STRING,
+		})
+		if k8sErrors.IsConflict(err) {
+			return AcquireNetworkLock(ctx, clientset, k8sConfig, operation)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	go lock.renew()
+
+	return lock, nil
+}
+
+// Lost is closed when the lock is no longer held, Err returns the reason afterwards
+func (l *NetworkLock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+func (l *NetworkLock) Err() error {
+	select {
+	case <-l.lost:
+		return l.err
+	default:
+		return nil
+	}
+}
+
+func (l *NetworkLock) lose(err error) {
+	l.err = err
+	close(l.lost)
+}
+
+func (l *NetworkLock) renew() {
+	defer close(l.done)
+	leaseClient := l.clientset.CoordinationV1().Leases(l.namespace)
+	renewed := time.Now()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-time.After(LOCK_RENEW_INTERVAL):
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), LOCK_RENEW_INTERVAL)
+		lease, err := leaseClient.Get(ctx, l.name, metav1.GetOptions{})
+		if err == nil && (lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != l.holder) {
+			cancel()
+			holder := "nobody"
+			if lease.Spec.HolderIdentity != nil {
+				holder = *lease.Spec.HolderIdentity
+			}
+			l.lose(fmt.Errorf("lock %s is now held by %s", l.name, holder))
+			return
+		}
+		if err == nil {
+			now := metav1.NewMicroTime(time.Now())
+			lease.Spec.RenewTime = &now
+			_, err = leaseClient.Update(ctx, lease, metav1.UpdateOptions{
+				FieldManager: FIELD_MANAGER_STRING,
+			})
+		}
+		cancel()
+
+		if err == nil {
+			renewed = time.Now()
+			continue
+		}
+		// the lease is gone together with the namespace when the network is destroyed
+		if k8sErrors.IsNotFound(err) || strings.Contains(err.Error(), "being terminated") {
+			continue
+		}
+
+		log.Printf("could not renew lock %s: %v\n", l.name, err)
+		// others may take over an expired lease
+		if time.Since(renewed) >= LOCK_LEASE_DURATION {
+			l.lose(fmt.Errorf("could not renew lock %s before it expired: %w", l.name, err))
+			return
+		}
+	}
+}
+
+// Release stops renewing the lease and deletes it if it is still held by this lock
+func (l *NetworkLock) Release(ctx context.Context) error {
+	select {
+	case <-l.done:
+		// the lock never had a lease
+		return nil
+	default:
+	}
+	close(l.stop)
+	<-l.done
+
+	leaseClient := l.clientset.CoordinationV1().Leases(l.namespace)
+	lease, err := leaseClient.Get(ctx, l.name, metav1.GetOptions{})
+	if k8sErrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != l.holder {
+		return nil
+	}
+
+	err = leaseClient.Delete(ctx, l.name, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{ResourceVersion: &lease.ResourceVersion},
+	})
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,283 @@
+/*
+ * logs.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"chain4travel.com/camktncr/pkg/version1"
+	"golang.org/x/sync/errgroup"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// camino-node logs can contain very long lines e.g. when printing blocks
+const MAX_LOG_LINE = 1024 * 1024
+
+// LOG_STREAM_RETRIES is how often a log stream may fail in a row without a line before following stops
+const LOG_STREAM_RETRIES = 5
+
+type LogOptions struct {
+	// Role restricts the logs to root, validator or api nodes
+	Role string
+	// Node restricts the logs to a single node, see Node.Matches
+	Node   string
+	Since  time.Duration
+	Grep   *regexp.Regexp
+	Follow bool
+}
+
+type LogLine struct {
+	Node
+	Line string `json:"line"`
+}
+
+// LogNodes returns the nodes selected by the options
+func LogNodes(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, options LogOptions) ([]Node, error) {
+	nodes, err := ListNodes(ctx, clientset, k8sConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.Node != "" {
+		node, err := FindNode(nodes, options.Node)
+		if err != nil {
+			return nil, err
+		}
+		return []Node{node}, nil
+	}
+
+	selected := make([]Node, 0, len(nodes))
+	for _, n := range nodes {
+		if options.Role == "" || n.Role == options.Role {
+			selected = append(selected, n)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no nodes found in %s", k8sConfig.Namespace)
+	}
+	return selected, nil
+}
+
+// StreamLogs concurrently reads the logs of all selected nodes and sends every line to lines.
+// When following, streams that end because a pod restarted are reopened until ctx is done
+func StreamLogs(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, options LogOptions, lines chan<- LogLine) error {
+	nodes, err := LogNodes(ctx, clientset, k8sConfig, options)
+	if err != nil {
+		return err
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	for _, node := range nodes {
+		node := node
+		g.Go(func() error {
+			// the timestamps tell where a reopened stream has to continue
+			logOptions := &corev1.PodLogOptions{
+				Container:  NODE_CONTAINER_NAME,
+				Follow:     options.Follow,
+				Timestamps: true,
+			}
+			if options.Since > 0 {
+				seconds := int64(options.Since.Seconds())
+				logOptions.SinceSeconds = &seconds
+			}
+
+			var last time.Time
+			failures := 0
+			for {
+				before := last
+				err := streamNodeLogs(ctx, clientset, k8sConfig.Namespace, node, logOptions, options.Grep, lines, &last)
+				if !options.Follow {
+					return err
+				}
+				if ctx.Err() != nil {
+					return nil
+				}
+
+				if err != nil && last.Equal(before) {
+					failures++
+					if failures >= LOG_STREAM_RETRIES {
+						return fmt.Errorf("stopped following %s after %d failed attempts: %w", node.Pod, failures, err)
+					}
+					log.Printf("retrying logs of %s: %v\n", node.Pod, err)
+				} else {
+					failures = 0
+				}
+
+				// continue after the last line received, the first lines of a restarted container
+				// are the interesting ones
+				if !last.IsZero() {
+					logOptions.SinceSeconds = nil
+					logOptions.SinceTime = &metav1.Time{Time: last}
+				}
+
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-time.After(DEFAULT_TIMEOUT):
+				}
+			}
+		})
+	}
+
+	return g.Wait()
+}
+
+// streamNodeLogs sends the lines of the stream that are newer than last and moves last to the
+// newest line. SinceTime only has a precision of seconds, so reopened streams repeat some lines
+func streamNodeLogs(ctx context.Context, clientset *kubernetes.Clientset, namespace string, node Node, logOptions *corev1.PodLogOptions, grep *regexp.Regexp, lines chan<- LogLine, last *time.Time) error {
+	stream, err := clientset.CoreV1().Pods(namespace).GetLogs(node.Pod, logOptions).Stream(ctx)
+	if err != nil {
+		return fmt.Errorf("could not read logs of %s: %w", node.Pod, err)
+	}
+	defer stream.Close()
+
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 64*1024), MAX_LOG_LINE)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if timestamp, rest, ok := strings.Cut(line, " "); ok {
+			t, err := time.Parse(time.RFC3339Nano, timestamp)
+			if err == nil {
+				if !t.After(*last) {
+					continue
+				}
+				*last = t
+				line = rest
+			}
+		}
+		if grep != nil && !grep.MatchString(line) {
+			continue
+		}
+		select {
+		case lines <- LogLine{Node: node, Line: line}:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// WriteLogBundle writes a gzipped tarball with the current and previous logs of the selected
+// nodes, their pod status and the events of the namespace, meant to be attached to bug reports
+func WriteLogBundle(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, options LogOptions, w io.Writer) error {
+	nodes, err := LogNodes(ctx, clientset, k8sConfig, options)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+
+	add := func(name string, data []byte) error {
+		err := tw.WriteHeader(&tar.Header{
+			Name:    fmt.Sprintf("%s/%s", k8sConfig.K8sPrefix, name),
+			Mode:    0644,
+			Size:    int64(len(data)),
+			ModTime: now,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = tw.Write(data)
+		return err
+	}
+
+	nodesJson, err := json.MarshalIndent(nodes, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = add("nodes.json", nodesJson)
+	if err != nil {
+		return err
+	}
+
+	for _, node := range nodes {
+		pod, err := clientset.CoreV1().Pods(k8sConfig.Namespace).Get(ctx, node.Pod, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		statusJson, err := json.MarshalIndent(pod.Status, "", "  ")
+		if err != nil {
+			return err
+		}
+		err = add(fmt.Sprintf("%s/status.json", node.Pod), statusJson)
+		if err != nil {
+			return err
+		}
+
+		for _, previous := range []bool{false, true} {
+			logOptions := &corev1.PodLogOptions{Container: NODE_CONTAINER_NAME, Previous: previous}
+			if options.Since > 0 {
+				seconds := int64(options.Since.Seconds())
+				logOptions.SinceSeconds = &seconds
+			}
+			logs, err := clientset.CoreV1().Pods(k8sConfig.Namespace).GetLogs(node.Pod, logOptions).DoRaw(ctx)
+			if err != nil {
+				// there are no previous logs if the container never restarted
+				if previous {
+					continue
+				}
+				return fmt.Errorf("could not read logs of %s: %w", node.Pod, err)
+			}
+			if options.Grep != nil {
+				logs = grepLines(logs, options.Grep)
+			}
+
+			name := fmt.Sprintf("%s/%s.log", node.Pod, NODE_CONTAINER_NAME)
+			if previous {
+				name = fmt.Sprintf("%s/%s.previous.log", node.Pod, NODE_CONTAINER_NAME)
+			}
+			err = add(name, logs)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	events, err := clientset.CoreV1().Events(k8sConfig.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	eventsJson, err := json.MarshalIndent(events.Items, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = add("events.json", eventsJson)
+	if err != nil {
+		return err
+	}
+
+	err = tw.Close()
+	if err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func grepLines(logs []byte, grep *regexp.Regexp) []byte {
+	var out bytes.Buffer
+	for _, line := range bytes.SplitAfter(logs, []byte("\n")) {
+		if grep.Match(line) {
+			out.Write(line)
+		}
+	}
+	return out.Bytes()
+}
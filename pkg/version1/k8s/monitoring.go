@@ -0,0 +1,190 @@
+/*
+ * monitoring.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"chain4travel.com/camktncr/pkg/version1"
+	promv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	promVersioned "github.com/prometheus-operator/prometheus-operator/pkg/client/versioned"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// label the grafana sidecar of kube-prometheus-stack discovers dashboards with by default
+const DEFAULT_DASHBOARD_LABEL = "grafana_dashboard=1"
+
+// placeholder in the dashboards that is replaced with the namespace of the network
+const DASHBOARD_NETWORK_PLACEHOLDER = "__NETWORK__"
+
+//go:embed dashboards
+var dashboardsFs embed.FS
+
+// CreateDashboards provisions a config map per grafana dashboard of the network, the dashboards
+// only show the metrics of the network namespace
+func CreateDashboards(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig) error {
+	labelKey, labelValue, ok := strings.Cut(k8sConfig.DashboardLabel, "=")
+	if !ok {
+		return fmt.Errorf("dashboard label must be key=value: %s", k8sConfig.DashboardLabel)
+	}
+
+	files, err := fs.Glob(dashboardsFs, "dashboards/*.json")
+	if err != nil {
+		return err
+	}
+
+	cmClient := clientset.CoreV1().ConfigMaps(k8sConfig.Namespace)
+	for _, file := range files {
+		raw, err := dashboardsFs.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		dashboard := strings.ReplaceAll(string(raw), DASHBOARD_NETWORK_PLACEHOLDER, k8sConfig.Namespace)
+
+		labels := map[string]string{labelKey: labelValue}
+		for k, v := range k8sConfig.Labels {
+			labels[k] = v
+		}
+
+		fileName := path.Base(file)
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      k8sConfig.PrefixWith("dashboard-" + strings.TrimSuffix(fileName, ".json")),
+				Namespace: k8sConfig.Namespace,
+				Labels:    labels,
+			},
+			Data: map[string]string{
+				fmt.Sprintf("%s-%s", k8sConfig.K8sPrefix, fileName): dashboard,
+			},
+		}
+
+		existing, err := cmClient.Get(ctx, cm.Name, metav1.GetOptions{})
+		if k8sErrors.IsNotFound(err) {
+			_, err = cmClient.Create(ctx, cm, metav1.CreateOptions{
+				FieldManager: FIELD_MANAGER_STRING,
+			})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		cm.ResourceVersion = existing.ResourceVersion
+		_, err = cmClient.Update(ctx, cm, metav1.UpdateOptions{
+			FieldManager: FIELD_MANAGER_STRING,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func buildAlertRules(k8sConfig version1.K8sConfig) *promv1.PrometheusRule {
+	ns := fmt.Sprintf(`namespace="%s"`, k8sConfig.Namespace)
+
+	alert := func(name string, expr string, forDuration string, severity string, summary string) promv1.Rule {
+		ruleLabels := map[string]string{"severity": severity}
+		for k, v := range k8sConfig.Labels {
+			ruleLabels[k] = v
+		}
+		return promv1.Rule{
+			Alert:  name,
+			Expr:   intstr.FromString(expr),
+			For:    forDuration,
+			Labels: ruleLabels,
+			Annotations: map[string]string{
+				"summary": summary,
+			},
+		}
+	}
+
+	return &promv1.PrometheusRule{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      k8sConfig.PrefixWith("alerts"),
+			Namespace: k8sConfig.Namespace,
+			Labels:    k8sConfig.Labels,
+		},
+		Spec: promv1.PrometheusRuleSpec{
+			Groups: []promv1.RuleGroup{
+				{
+					Name: k8sConfig.PrefixWith("nodes"),
+					Rules: []promv1.Rule{
+						alert("CaminoNodeDown",
+							fmt.Sprintf(`up{%s} == 0`, ns),
+							"5m", "critical",
+							"{{ $labels.pod }} of network {{ $labels.namespace }} cannot be scraped"),
+						// the readiness probe of the nodes (probe.sh) checks if the P-, X- and C-chain are bootstrapped
+						alert("CaminoNodeNotBootstrapped",
+							fmt.Sprintf(`kube_pod_status_ready{%s,condition="true"} == 0`, ns),
+							"15m", "warning",
+							"{{ $labels.pod }} of network {{ $labels.namespace }} has not bootstrapped its P-, X- and C-chain for 15 minutes"),
+						alert("CaminoValidatorUptimeDrop",
+							fmt.Sprintf(`avalanche_network_node_uptime_weighted_average{%s} < 80`, ns),
+							"10m", "warning",
+							"{{ $labels.pod }} of network {{ $labels.namespace }} is seen online by only {{ $value }}% of the stake"),
+					},
+				},
+				{
+					Name: k8sConfig.PrefixWith("consensus"),
+					Rules: []promv1.Rule{
+						alert("CaminoPChainHeightDivergence",
+							fmt.Sprintf(`max(avalanche_P_last_accepted_height{%[1]s}) by (namespace) - min(avalanche_P_last_accepted_height{%[1]s}) by (namespace) > 10`, ns),
+							"5m", "warning",
+							"the P-chain heights of the nodes of network {{ $labels.namespace }} differ by {{ $value }} blocks"),
+						alert("CaminoCChainHeightDivergence",
+							fmt.Sprintf(`max(avalanche_C_last_accepted_height{%[1]s}) by (namespace) - min(avalanche_C_last_accepted_height{%[1]s}) by (namespace) > 10`, ns),
+							"5m", "warning",
+							"the C-chain heights of the nodes of network {{ $labels.namespace }} differ by {{ $value }} blocks"),
+					},
+				},
+			},
+		},
+	}
+}
+
+// CreateAlertRules provisions the prometheus alert rules of the network
+func CreateAlertRules(ctx context.Context, restClient *rest.Config, k8sConfig version1.K8sConfig) error {
+	promClientSet, err := promVersioned.NewForConfig(restClient)
+	if err != nil {
+		return err
+	}
+
+	rule := buildAlertRules(k8sConfig)
+	client := promClientSet.MonitoringV1().PrometheusRules(k8sConfig.Namespace)
+
+	existing, err := client.Get(ctx, rule.Name, metav1.GetOptions{})
+	if k8sErrors.IsNotFound(err) {
+		_, err = client.Create(ctx, rule, metav1.CreateOptions{
+			FieldManager: FIELD_MANAGER_STRING,
+		})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	rule.ResourceVersion = existing.ResourceVersion
+	_, err = client.Update(ctx, rule, metav1.UpdateOptions{
+		FieldManager: FIELD_MANAGER_STRING,
+	})
+	return err
+}
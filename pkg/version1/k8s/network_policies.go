@@ -0,0 +1,141 @@
+/*
+ * network_policies.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"context"
+	"strings"
+
+	"chain4travel.com/camktncr/pkg/version1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+)
+
+const NAMESPACE_NAME_LABEL = "kubernetes.io/metadata.name"
+const MAX_NODE_PORT = 32767
+
+func namespacePeer(namespace string) networkingv1.NetworkPolicyPeer {
+	return networkingv1.NetworkPolicyPeer{
+		NamespaceSelector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{NAMESPACE_NAME_LABEL: namespace},
+		},
+	}
+}
+
+// allowListPeer turns an entry of the allow list into a peer, entries containing a slash
+// are treated as CIDR and everything else as namespace name
+func allowListPeer(entry string) networkingv1.NetworkPolicyPeer {
+	if strings.Contains(entry, "/") {
+		return networkingv1.NetworkPolicyPeer{
+			IPBlock: &networkingv1.IPBlock{CIDR: entry},
+		}
+	}
+	return namespacePeer(entry)
+}
+
+func policyPort(port int) []networkingv1.NetworkPolicyPort {
+	protocol := corev1.ProtocolTCP
+	target := intstr.FromInt(port)
+	return []networkingv1.NetworkPolicyPort{{Protocol: &protocol, Port: &target}}
+}
+
+func buildNetworkPolicies(k8sConfig version1.K8sConfig) []networkingv1.NetworkPolicy {
+	policies := k8sConfig.NetworkPolicies
+	networkPods := networkingv1.NetworkPolicyPeer{PodSelector: k8sConfig.Selector()}
+
+	rpcPeers := []networkingv1.NetworkPolicyPeer{networkPods}
+	for _, ns := range policies.IngressNamespaces {
+		rpcPeers = append(rpcPeers, namespacePeer(ns))
+	}
+	for _, ns := range policies.MonitoringNamespaces {
+		rpcPeers = append(rpcPeers, namespacePeer(ns))
+	}
+	for _, entry := range policies.Allow {
+		rpcPeers = append(rpcPeers, allowListPeer(entry))
+	}
+
+	stakingPolicy := networkingv1.NetworkPolicyIngressRule{
+		From:  []networkingv1.NetworkPolicyPeer{networkPods},
+		Ports: policyPort(STAKING_PORT),
+	}
+
+	// an empty peer list allows traffic from everywhere
+	switch k8sConfig.P2PExposure {
+	case version1.P2P_EXPOSURE_LOADBALANCER:
+		stakingPolicy.From = nil
+	case version1.P2P_EXPOSURE_NODEPORT:
+		// validators listen on their own node port which is not known per pod here
+		endPort := int32(MAX_NODE_PORT)
+		stakingPolicy.From = nil
+		stakingPolicy.Ports = policyPort(int(k8sConfig.P2PNodePortBase))
+		stakingPolicy.Ports[0].EndPort = &endPort
+	}
+
+	return []networkingv1.NetworkPolicy{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      k8sConfig.PrefixWith("rpc"),
+				Namespace: k8sConfig.Namespace,
+				Labels:    k8sConfig.Labels,
+			},
+			Spec: networkingv1.NetworkPolicySpec{
+				PodSelector: *k8sConfig.Selector(),
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+				Ingress: []networkingv1.NetworkPolicyIngressRule{
+					{
+						From:  rpcPeers,
+						Ports: policyPort(9650),
+					},
+				},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      k8sConfig.PrefixWith("staking"),
+				Namespace: k8sConfig.Namespace,
+				Labels:    k8sConfig.Labels,
+			},
+			Spec: networkingv1.NetworkPolicySpec{
+				PodSelector: *k8sConfig.Selector(),
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+				Ingress:     []networkingv1.NetworkPolicyIngressRule{stakingPolicy},
+			},
+		},
+	}
+}
+
+// CreateNetworkPolicies isolates the pods of the network: p2p traffic is only allowed between the
+// pods of the network and the http api only from the network itself, the ingress controller, the
+// monitoring namespaces and the allow list
+func CreateNetworkPolicies(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig) error {
+	npClient := clientset.NetworkingV1().NetworkPolicies(k8sConfig.Namespace)
+
+	for _, np := range buildNetworkPolicies(k8sConfig) {
+		found, foundErr := npClient.Get(ctx, np.Name, metav1.GetOptions{})
+		if foundErr == nil {
+			np.ResourceVersion = found.ResourceVersion
+			_, err := npClient.Update(ctx, &np, metav1.UpdateOptions{
+				FieldManager: FIELD_MANAGER_STRING,
+			})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		_, err := npClient.Create(ctx, &np, metav1.CreateOptions{
+			FieldManager: FIELD_MANAGER_STRING,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+/*
+ * network_store.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"chain4travel.com/camktncr/pkg/version1"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	STORED_NETWORK_KEY    = "network.enc"
+	STORED_K8S_CONFIG_KEY = "k8s-config.json"
+)
+
+func networkStoreName(k8sConfig version1.K8sConfig) string {
+	return k8sConfig.PrefixWith("network")
+}
+
+// StoreNetwork persists the encrypted network definition and the k8s configuration it was
+// created with, so other team members can pull the network file from the cluster
+func StoreNetwork(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, network *version1.Network, passphrase string) error {
+	encrypted, err := version1.EncryptNetwork(network, passphrase)
+	if err != nil {
+		return err
+	}
+	configJson, err := json.Marshal(k8sConfig)
+	if err != nil {
+		return err
+	}
+
+	secretClient := clientset.CoreV1().Secrets(k8sConfig.Namespace)
+	data := map[string][]byte{
+		STORED_NETWORK_KEY:    encrypted,
+		STORED_K8S_CONFIG_KEY: configJson,
+	}
+
+	secret, err := secretClient.Get(ctx, networkStoreName(k8sConfig), metav1.GetOptions{})
+	if k8sErrors.IsNotFound(err) {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      networkStoreName(k8sConfig),
+				Namespace: k8sConfig.Namespace,
+				Labels:    k8sConfig.Labels,
+			},
+			Type: corev1.SecretTypeOpaque,
+			Data: data,
+		}
+		_, err = secretClient.Create(ctx, secret, metav1.CreateOptions{
+			FieldManager: FIELD_MANAGER_STRING,
+		})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	secret.Data = data
+	_, err = secretClient.Update(ctx, secret, metav1.UpdateOptions{
+		FieldManager: FIELD_MANAGER_STRING,
+	})
+	return err
+}
+
+// PullNetwork returns the network definition and k8s configuration stored by StoreNetwork
+func PullNetwork(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, passphrase string) (*version1.Network, *version1.K8sConfig, error) {
+	secret, err := clientset.CoreV1().Secrets(k8sConfig.Namespace).Get(ctx, networkStoreName(k8sConfig), metav1.GetOptions{})
+	if k8sErrors.IsNotFound(err) {
+		return nil, nil, fmt.Errorf("network %s was not stored in the cluster, create it with --store-network", k8sConfig.K8sPrefix)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	encrypted, ok := secret.Data[STORED_NETWORK_KEY]
+	if !ok {
+		return nil, nil, fmt.Errorf("secret %s does not contain %s", secret.Name, STORED_NETWORK_KEY)
+	}
+	network, err := version1.DecryptNetwork(encrypted, passphrase)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var storedConfig version1.K8sConfig
+	err = json.Unmarshal(secret.Data[STORED_K8S_CONFIG_KEY], &storedConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read stored k8s config: %w", err)
+	}
+
+	return network, &storedConfig, nil
+}
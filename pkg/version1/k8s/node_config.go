@@ -0,0 +1,220 @@
+/*
+ * node_config.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"chain4travel.com/camktncr/pkg/version1"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	NODE_CONFIG_VOLUME_NAME = "node-config-vol"
+	NODE_CONFIG_MOUNT_PATH  = "/mnt/node-config"
+	// changes of the node config are rolled out by changing this annotation of the pod template
+	NODE_CONFIG_HASH_ANNOTATION = "camktncr/node-config-hash"
+)
+
+// NODE_CONFIG_ROLES are the roles with their own config file, root and validators share one
+var NODE_CONFIG_ROLES = []string{"validator", "api", "archive"}
+
+// START_SCRIPT_FLAGS are set per pod by start.sh and take precedence over the config file,
+// all staking-tls-* flags are reserved as well
+var START_SCRIPT_FLAGS = []string{"network-id", "public-ip", "staking-port", "bootstrap-ids", "bootstrap-ips", "config-file", "chain-config-dir"}
+
+const START_SCRIPT_FLAG_PREFIX = "staking-tls-"
+
+// ValidateNodeFlags rejects flags that start.sh sets for every pod, they would be silently ignored
+func ValidateNodeFlags(flags map[string]string) error {
+	for flag := range flags {
+		reserved := strings.HasPrefix(flag, START_SCRIPT_FLAG_PREFIX)
+		for _, f := range START_SCRIPT_FLAGS {
+			reserved = reserved || flag == f
+		}
+		if reserved {
+			return fmt.Errorf("node flag '%s' is set by the start script of every pod and cannot be configured", flag)
+		}
+	}
+	return nil
+}
+
+func nodeConfigMapName(k8sConfig version1.K8sConfig) string {
+	return k8sConfig.PrefixWith("node-config")
+}
+
+// NodeConfigRole is the role whose config file the stateful set runs with
+func (s stateFullSetOptions) NodeConfigRole() string {
+	if s.IsValidator {
+		return "validator"
+	}
+	return s.Type
+}
+
+func nodeConfigFor(k8sConfig version1.K8sConfig, role string) version1.K8sNodeConfig {
+	switch role {
+	case "api":
+		return k8sConfig.NodeConfigs.Api
+	case "archive":
+		return archiveNodeConfig(k8sConfig)
+	}
+	return k8sConfig.NodeConfigs.Validator
+}
+
+// archiveNodeConfig adds a C-chain config that keeps the full history
+func archiveNodeConfig(k8sConfig version1.K8sConfig) version1.K8sNodeConfig {
+	config := k8sConfig.NodeConfigs.Archive
+	if _, ok := config.ChainConfigs["C"]; ok {
+		return config
+	}
+
+	cChainConfig, _ := json.Marshal(version1.CChainConfig{
+		PruningEnabled: false,
+		TxLookupLimit:  k8sConfig.ArchiveTxLookupLimit,
+	})
+
+	chainConfigs := make(map[string]string, len(config.ChainConfigs)+1)
+	for k, v := range config.ChainConfigs {
+		chainConfigs[k] = v
+	}
+	chainConfigs["C"] = string(cChainConfig)
+
+	return version1.K8sNodeConfig{
+		Flags:        config.Flags,
+		ChainConfigs: chainConfigs,
+	}
+}
+
+// defaultNodeConfig contains everything that is the same for all pods of a role,
+// the addresses and certificates of a pod are passed as flags by start.sh
+func defaultNodeConfig(role string) version1.NodeConfig {
+	return version1.NodeConfig{
+		DBDir:              "/mnt/data",
+		GenesisFile:        "/mnt/conf/genesis.json",
+		HttpHost:           "0.0.0.0",
+		HttpPort:           HTTP_PORT,
+		HttpAllowedOrigins: "*",
+		ApiAdminEnabled:    true,
+		LogLevel:           "debug",
+		IndexEnabled:       role != "validator",
+	}
+}
+
+func nodeConfigKey(role string) string {
+	return fmt.Sprintf("%s.json", role)
+}
+
+func chainConfigKey(role string, chain string) string {
+	return fmt.Sprintf("%s.chain.%s.json", role, chain)
+}
+
+func buildNodeConfigData(k8sConfig version1.K8sConfig) (map[string]string, error) {
+	data := map[string]string{}
+
+	for _, role := range NODE_CONFIG_ROLES {
+		nodeConfig := nodeConfigFor(k8sConfig, role)
+
+		err := ValidateNodeFlags(nodeConfig.Flags)
+		if err != nil {
+			return nil, fmt.Errorf("invalid node config of %s: %w", role, err)
+		}
+		config, err := defaultNodeConfig(role).Render(nodeConfig.Flags)
+		if err != nil {
+			return nil, err
+		}
+		data[nodeConfigKey(role)] = string(config)
+
+		for chain, chainConfig := range nodeConfig.ChainConfigs {
+			if !json.Valid([]byte(chainConfig)) {
+				return nil, fmt.Errorf("chain config of %s for %s is not valid json", chain, role)
+			}
+			data[chainConfigKey(role, chain)] = chainConfig
+		}
+	}
+
+	return data, nil
+}
+
+// nodeConfigHash changes whenever the config of the role of the stateful set changes
+func nodeConfigHash(options stateFullSetOptions) string {
+	// maps are marshalled with sorted keys
+	raw, _ := json.Marshal(nodeConfigFor(options.K8sConfig, options.NodeConfigRole()))
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:8])
+}
+
+// nodeConfigVolume mounts the config file of the role as config.json and its
+// chain configs as chains/<chain>/config.json
+func nodeConfigVolume(options stateFullSetOptions) corev1.Volume {
+	role := options.NodeConfigRole()
+	items := []corev1.KeyToPath{
+		{Key: nodeConfigKey(role), Path: "config.json"},
+	}
+	for chain := range nodeConfigFor(options.K8sConfig, role).ChainConfigs {
+		items = append(items, corev1.KeyToPath{
+			Key:  chainConfigKey(role, chain),
+			Path: path.Join("chains", chain, "config.json"),
+		})
+	}
+
+	return corev1.Volume{
+		Name: NODE_CONFIG_VOLUME_NAME,
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: nodeConfigMapName(options.K8sConfig),
+				},
+				Items: items,
+			},
+		},
+	}
+}
+
+// CreateNodeConfigMap renders the config file and chain configs of every role into a config map
+func CreateNodeConfigMap(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig) error {
+	data, err := buildNodeConfigData(k8sConfig)
+	if err != nil {
+		return err
+	}
+
+	cmClient := clientset.CoreV1().ConfigMaps(k8sConfig.Namespace)
+	name := nodeConfigMapName(k8sConfig)
+
+	cm, err := cmClient.Get(ctx, name, metav1.GetOptions{})
+	if k8sErrors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: k8sConfig.Namespace,
+				Labels:    k8sConfig.Labels,
+			},
+			Data: data,
+		}
+		_, err = cmClient.Create(ctx, cm, metav1.CreateOptions{
+			FieldManager: FIELD_MANAGER_STRING,
+		})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	cm.Data = data
+	_, err = cmClient.Update(ctx, cm, metav1.UpdateOptions{
+		FieldManager: FIELD_MANAGER_STRING,
+	})
+	return err
+}
@@ -0,0 +1,131 @@
+/*
+ * nodes.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"chain4travel.com/camktncr/pkg/version1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const NODE_CONTAINER_NAME = "camino-node"
+
+// Node is a running pod of the network together with the staker it was started with
+type Node struct {
+	Pod     string `json:"pod"`
+	Role    string `json:"role"`
+	Ordinal int32  `json:"ordinal"`
+	// NodeID is empty for api nodes, they do not run with a staker of the network
+	NodeID string `json:"nodeId,omitempty"`
+	// Image is the camino-node image the pod runs with
+	Image string `json:"image"`
+}
+
+// Name is the short name of the node as used in the node routes, e.g. validator-3
+func (n Node) Name() string {
+	return fmt.Sprintf("%s-%d", n.Role, n.Ordinal)
+}
+
+// Matches reports if the node is addressed by name, which may be the pod name,
+// the short name or the node id with or without the NodeID- prefix
+func (n Node) Matches(name string) bool {
+	if name == n.Pod || name == n.Name() {
+		return true
+	}
+	return n.NodeID != "" && strings.TrimPrefix(name, "NodeID-") == strings.TrimPrefix(n.NodeID, "NodeID-")
+}
+
+// ListNodes returns the pods of the network ordered by role and ordinal and resolves
+// the node ids of root and validators from the staker secrets
+func ListNodes(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig) ([]Node, error) {
+	selector, err := metav1.LabelSelectorAsSelector(k8sConfig.Selector())
+	if err != nil {
+		return nil, err
+	}
+	pods, err := clientset.CoreV1().Pods(k8sConfig.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: selector.String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	secrets, err := stakerSecrets(ctx, clientset, k8sConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make([]Node, 0, len(pods.Items))
+	for _, pod := range pods.Items {
+		role, ok := pod.Labels["type"]
+		if !ok {
+			continue
+		}
+		// the pods of roles that run per node are all the first ones of their stateful set
+		idx := strings.LastIndex(pod.Name, "-")
+		ordinalString := pod.Name[idx+1:]
+		if label, ok := pod.Labels[NODE_ORDINAL_LABEL]; ok {
+			ordinalString = label
+		}
+		ordinal, err := strconv.Atoi(ordinalString)
+		if err != nil {
+			continue
+		}
+
+		options := stateFullSetOptions{K8sConfig: k8sConfig, Type: role, IsRoot: role == "root"}
+		node := Node{Pod: pod.Name, Role: role, Ordinal: int32(ordinal)}
+		for _, c := range pod.Spec.Containers {
+			if c.Name == NODE_CONTAINER_NAME {
+				node.Image = c.Image
+			}
+		}
+		if role == "root" || role == "validator" {
+			stakerIndex := int(options.StakerIndex(int32(ordinal)))
+			if stakerIndex < len(secrets) {
+				node.NodeID = string(secrets[stakerIndex].Data[NODE_ID_KEY])
+			}
+		}
+		nodes = append(nodes, node)
+	}
+
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].Role != nodes[j].Role {
+			return roleOrder(nodes[i].Role) < roleOrder(nodes[j].Role)
+		}
+		return nodes[i].Ordinal < nodes[j].Ordinal
+	})
+	return nodes, nil
+}
+
+func roleOrder(role string) int {
+	switch role {
+	case "root":
+		return 0
+	case "validator":
+		return 1
+	case "api":
+		return 2
+	case "archive":
+		return 3
+	}
+	return 4
+}
+
+// FindNode returns the node addressed by name, see Node.Matches
+func FindNode(nodes []Node, name string) (Node, error) {
+	for _, n := range nodes {
+		if n.Matches(name) {
+			return n, nil
+		}
+	}
+	return Node{}, fmt.Errorf("could not find node %s", name)
+}
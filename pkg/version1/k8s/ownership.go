@@ -0,0 +1,128 @@
+/*
+ * ownership.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/user"
+	"time"
+
+	"chain4travel.com/camktncr/pkg"
+	"chain4travel.com/camktncr/pkg/version1"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	MANAGED_BY_LABEL      = "app.kubernetes.io/managed-by"
+	MANAGED_BY_VALUE      = "camktncr"
+	CREATOR_ANNOTATION    = "camktncr.chain4travel.com/creator"
+	VERSION_ANNOTATION    = "camktncr.chain4travel.com/version"
+	NETWORK_ANNOTATION    = "camktncr.chain4travel.com/network"
+	CREATED_AT_ANNOTATION = "camktncr.chain4travel.com/created-at"
+)
+
+const NAMESPACE_TERMINATION_TIMEOUT = 10 * time.Minute
+
+var ErrNamespaceNotOwned = fmt.Errorf("namespace is not owned by camktncr")
+
+func creator() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	if host, err := os.Hostname(); err == nil {
+		name = fmt.Sprintf("%s@%s", name, host)
+	}
+	return name
+}
+
+func ownershipMarkers(k8sConfig version1.K8sConfig) (map[string]string, map[string]string) {
+	labels := map[string]string{
+		MANAGED_BY_LABEL: MANAGED_BY_VALUE,
+	}
+	annotations := map[string]string{
+		CREATOR_ANNOTATION:    creator(),
+		VERSION_ANNOTATION:    pkg.Commit,
+		NETWORK_ANNOTATION:    k8sConfig.K8sPrefix,
+		CREATED_AT_ANNOTATION: time.Now().UTC().Format(time.RFC3339),
+	}
+	return labels, annotations
+}
+
+func isOwned(namespace *corev1.Namespace, k8sConfig version1.K8sConfig) bool {
+	return namespace.Labels[MANAGED_BY_LABEL] == MANAGED_BY_VALUE && namespace.Annotations[NETWORK_ANNOTATION] == k8sConfig.K8sPrefix
+}
+
+// CheckNamespaceOwnership fails if the namespace of the network exists but was not created by camktncr for this network
+func CheckNamespaceOwnership(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig) error {
+	namespace, err := clientset.CoreV1().Namespaces().Get(ctx, k8sConfig.Namespace, metav1.GetOptions{})
+	if k8sErrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !isOwned(namespace, k8sConfig) {
+		return fmt.Errorf("%w: %s (use --force to ignore)", ErrNamespaceNotOwned, k8sConfig.Namespace)
+	}
+	return nil
+}
+
+// DeleteNamespace deletes the namespace of the network and waits until it is actually gone.
+// Only namespaces camktncr created for the network are deleted, there is no way to force it
+func DeleteNamespace(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig) error {
+	nsClient := clientset.CoreV1().Namespaces()
+
+	namespace, err := nsClient.Get(ctx, k8sConfig.Namespace, metav1.GetOptions{})
+	if k8sErrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !isOwned(namespace, k8sConfig) {
+		return fmt.Errorf("%w: refusing to delete %s", ErrNamespaceNotOwned, k8sConfig.Namespace)
+	}
+
+	// the uid makes sure a namespace recreated in the meantime is not deleted
+	err = nsClient.Delete(ctx, k8sConfig.Namespace, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{UID: &namespace.UID},
+	})
+	if k8sErrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, NAMESPACE_TERMINATION_TIMEOUT)
+	defer cancel()
+
+	for {
+		_, err := nsClient.Get(ctx, k8sConfig.Namespace, metav1.GetOptions{})
+		if k8sErrors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		log.Printf("waiting for namespace %s to terminate\n", k8sConfig.Namespace)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("namespace %s did not terminate: %w", k8sConfig.Namespace, ctx.Err())
+		case <-time.After(DEFAULT_TIMEOUT):
+		}
+	}
+}
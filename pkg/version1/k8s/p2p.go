@@ -0,0 +1,227 @@
+/*
+ * p2p.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"time"
+
+	"chain4travel.com/camktncr/pkg/version1"
+	"golang.org/x/sync/errgroup"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+)
+
+const P2P_LOADBALANCER_TIMEOUT = 10 * time.Minute
+
+func p2pConfigMapName(k8sConfig version1.K8sConfig) string {
+	return k8sConfig.PrefixWith("p2p")
+}
+
+func p2pServiceName(options stateFullSetOptions, ordinal int32) string {
+	return fmt.Sprintf("%s-p2p", options.PodName(ordinal))
+}
+
+func buildP2PService(options stateFullSetOptions, ordinal int32) corev1.Service {
+	podName := options.PodName(ordinal)
+	port := options.StakingPort(ordinal)
+
+	labels := options.Labels()
+	labels[P2P_LABEL] = "true"
+
+	selector := options.Labels()
+	selector[appsv1.StatefulSetPodNameLabel] = podName
+
+	servicePort := corev1.ServicePort{
+		Name:       "staking",
+		Port:       port,
+		TargetPort: intstr.FromInt(int(port)),
+	}
+
+	serviceType := corev1.ServiceTypeLoadBalancer
+	if options.P2PExposure == version1.P2P_EXPOSURE_NODEPORT {
+		serviceType = corev1.ServiceTypeNodePort
+		servicePort.NodePort = port
+	}
+
+	return corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      p2pServiceName(options, ordinal),
+			Namespace: options.Namespace,
+			Labels:    labels,
+		},
+		Spec: corev1.ServiceSpec{
+			Type:                     serviceType,
+			Ports:                    []corev1.ServicePort{servicePort},
+			PublishNotReadyAddresses: true,
+			Selector:                 selector,
+		},
+	}
+}
+
+// waitForLoadBalancerIP blocks until the cloud provider assigned an address to the service
+func waitForLoadBalancerIP(ctx context.Context, clientset *kubernetes.Clientset, namespace string, name string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, P2P_LOADBALANCER_TIMEOUT)
+	defer cancel()
+
+	for {
+		svc, err := clientset.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+
+		for _, ingress := range svc.Status.LoadBalancer.Ingress {
+			if ingress.IP != "" {
+				return ingress.IP, nil
+			}
+			if ingress.Hostname != "" {
+				ips, err := net.DefaultResolver.LookupIP(ctx, "ip4", ingress.Hostname)
+				if err == nil && len(ips) > 0 {
+					return ips[0].String(), nil
+				}
+			}
+		}
+
+		log.Printf("waiting for load balancer address of %s\n", name)
+
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("service %s did not get a load balancer address: %w", name, ctx.Err())
+		case <-time.After(DEFAULT_TIMEOUT):
+		}
+	}
+}
+
+// exposeStakingPorts creates an externally reachable service for the staking port of every pod
+// and records the public address each node has to announce in the p2p config map.
+// The config map is mounted into the pods and read by start.sh
+func exposeStakingPorts(ctx context.Context, clientset *kubernetes.Clientset, options stateFullSetOptions) error {
+	data := map[string]string{}
+
+	for i := int32(0); i < options.Replicas; i++ {
+		svc := buildP2PService(options, i)
+		err := createOrUpdateService(ctx, clientset, svc)
+		if err != nil {
+			return err
+		}
+
+		podName := options.PodName(i)
+		data[podName+".port"] = strconv.Itoa(int(options.StakingPort(i)))
+
+		// without a configured address the pods announce the ip of the node they are scheduled on
+		if options.P2PExposure == version1.P2P_EXPOSURE_NODEPORT && options.P2PPublicIP != "" {
+			data[podName+".ip"] = options.P2PPublicIP
+		}
+	}
+
+	if options.P2PExposure == version1.P2P_EXPOSURE_LOADBALANCER {
+		// the cloud provider assigns the addresses independently, waiting in order would add up
+		ips := make([]string, options.Replicas)
+		g, gCtx := errgroup.WithContext(ctx)
+		for i := int32(0); i < options.Replicas; i++ {
+			i := i
+			g.Go(func() error {
+				ip, err := waitForLoadBalancerIP(gCtx, clientset, options.Namespace, p2pServiceName(options, i))
+				if err != nil {
+					return err
+				}
+				ips[i] = ip
+				return nil
+			})
+		}
+		err := g.Wait()
+		if err != nil {
+			return err
+		}
+		for i, ip := range ips {
+			data[options.PodName(int32(i))+".ip"] = ip
+		}
+	}
+
+	cmClient := clientset.CoreV1().ConfigMaps(options.Namespace)
+	name := p2pConfigMapName(options.K8sConfig)
+
+	cm, err := cmClient.Get(ctx, name, metav1.GetOptions{})
+	if k8sErrors.IsNotFound(err) {
+		cm = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: options.Namespace,
+				Labels:    options.K8sConfig.Labels,
+			},
+			Data: data,
+		}
+		_, err = cmClient.Create(ctx, cm, metav1.CreateOptions{
+			FieldManager: FIELD_MANAGER_STRING,
+		})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	for k, v := range data {
+		cm.Data[k] = v
+	}
+	_, err = cmClient.Update(ctx, cm, metav1.UpdateOptions{
+		FieldManager: FIELD_MANAGER_STRING,
+	})
+	return err
+}
+
+// P2PBootstrapPeers returns the node ids and public staking addresses a node outside
+// of the cluster needs to join the network. stakers are expected in the order they are
+// assigned to the root node and validators
+func P2PBootstrapPeers(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, stakers []version1.Staker) ([]string, []string, error) {
+	cm, err := clientset.CoreV1().ConfigMaps(k8sConfig.Namespace).Get(ctx, p2pConfigMapName(k8sConfig), metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ids := make([]string, 0, len(stakers))
+	ips := make([]string, 0, len(stakers))
+
+	for i, s := range stakers {
+		options := stateFullSetOptions{K8sConfig: k8sConfig, Type: "root", IsValidator: true, IsRoot: true}
+		ordinal := int32(i)
+		if i > 0 {
+			options = stateFullSetOptions{K8sConfig: k8sConfig, Type: "validator", IsValidator: true}
+			ordinal = int32(i - 1)
+		}
+
+		podName := options.PodName(ordinal)
+		port, ok := cm.Data[podName+".port"]
+		if !ok {
+			continue
+		}
+
+		ip, ok := cm.Data[podName+".ip"]
+		if !ok {
+			pod, err := clientset.CoreV1().Pods(k8sConfig.Namespace).Get(ctx, podName, metav1.GetOptions{})
+			if err != nil {
+				return nil, nil, err
+			}
+			ip = pod.Status.HostIP
+		}
+
+		ids = append(ids, s.NodeID.String())
+		ips = append(ips, net.JoinHostPort(ip, port))
+	}
+
+	return ids, ips, nil
+}
@@ -0,0 +1,252 @@
+/*
+ * pipeline.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"chain4travel.com/camktncr/pkg/version1"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const PIPELINE_STATE_KEY = "state.json"
+const PIPELINE_SAVE_TIMEOUT = 30 * time.Second
+
+const (
+	STEP_COMPLETED = "completed"
+	STEP_FAILED    = "failed"
+	STEP_SKIPPED   = "skipped"
+)
+
+// Step is a named part of a pipeline, steps have to be safe to rerun
+type Step struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+type PipelineOptions struct {
+	// Resume skips the steps that completed in a previous run
+	Resume bool
+	// Only runs just these steps
+	Only []string
+	// Skip does not run these steps
+	Skip []string
+}
+
+// StepResult is the outcome of a step, it is recorded in the cluster after every step
+type StepResult struct {
+	Name        string     `json:"name"`
+	Status      string     `json:"status"`
+	Duration    string     `json:"duration,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+}
+
+func pipelineStateName(k8sConfig version1.K8sConfig, pipeline string) string {
+	return k8sConfig.PrefixWith(pipeline + "-state")
+}
+
+func loadPipelineState(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, pipeline string) (map[string]StepResult, error) {
+	cm, err := clientset.CoreV1().ConfigMaps(k8sConfig.Namespace).Get(ctx, pipelineStateName(k8sConfig, pipeline), metav1.GetOptions{})
+	if k8sErrors.IsNotFound(err) {
+		return map[string]StepResult{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var results []StepResult
+	err = json.Unmarshal([]byte(cm.Data[PIPELINE_STATE_KEY]), &results)
+	if err != nil {
+		return nil, fmt.Errorf("could not read state of %s: %w", cm.Name, err)
+	}
+
+	state := make(map[string]StepResult, len(results))
+	for _, r := range results {
+		state[r.Name] = r
+	}
+	return state, nil
+}
+
+func savePipelineState(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, pipeline string, results []StepResult) error {
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	cmClient := clientset.CoreV1().ConfigMaps(k8sConfig.Namespace)
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pipelineStateName(k8sConfig, pipeline),
+			Namespace: k8sConfig.Namespace,
+			Labels:    k8sConfig.Labels,
+		},
+		Data: map[string]string{
+			PIPELINE_STATE_KEY: string(data),
+		},
+	}
+
+	existing, err := cmClient.Get(ctx, cm.Name, metav1.GetOptions{})
+	if k8sErrors.IsNotFound(err) {
+		_, err = cmClient.Create(ctx, cm, metav1.CreateOptions{
+			FieldManager: FIELD_MANAGER_STRING,
+		})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	cm.ResourceVersion = existing.ResourceVersion
+	_, err = cmClient.Update(ctx, cm, metav1.UpdateOptions{
+		FieldManager: FIELD_MANAGER_STRING,
+	})
+	return err
+}
+
+// StepNames are the names of the steps in the order they run
+func StepNames(steps []Step) []string {
+	names := make([]string, len(steps))
+	for i, s := range steps {
+		names[i] = s.Name
+	}
+	return names
+}
+
+func validateStepNames(steps []Step, names []string) (map[string]bool, error) {
+	known := map[string]bool{}
+	for _, s := range steps {
+		known[s.Name] = true
+	}
+
+	set := map[string]bool{}
+	for _, name := range names {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown step '%s' (%s)", name, strings.Join(StepNames(steps), ", "))
+		}
+		set[name] = true
+	}
+	return set, nil
+}
+
+// selectSteps returns the names of the steps that have to run given the recorded state
+// of previous runs
+func selectSteps(steps []Step, state map[string]StepResult, options PipelineOptions) (map[string]bool, error) {
+	only, err := validateStepNames(steps, options.Only)
+	if err != nil {
+		return nil, err
+	}
+	skip, err := validateStepNames(steps, options.Skip)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := map[string]bool{}
+	for _, step := range steps {
+		previous, ran := state[step.Name]
+		switch {
+		case len(only) > 0 && !only[step.Name],
+			skip[step.Name],
+			options.Resume && len(only) == 0 && ran && previous.Status == STEP_COMPLETED:
+			continue
+		}
+		selected[step.Name] = true
+	}
+	return selected, nil
+}
+
+// loadsPipelineState reports if a run continues from the recorded state. A fresh run forgets about
+// previous runs, partial runs keep the state of the other steps
+func loadsPipelineState(options PipelineOptions) bool {
+	return options.Resume || len(options.Only) > 0
+}
+
+// RunPipeline runs the steps in order and records the result of every step in a config map of the
+// network, so a failed run can be resumed from the step that failed
+func RunPipeline(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, pipeline string, steps []Step, options PipelineOptions) ([]StepResult, error) {
+	// validate the names before touching the cluster
+	_, err := selectSteps(steps, nil, options)
+	if err != nil {
+		return nil, err
+	}
+
+	state := map[string]StepResult{}
+	if loadsPipelineState(options) {
+		state, err = loadPipelineState(ctx, clientset, k8sConfig, pipeline)
+		if err != nil {
+			return nil, err
+		}
+	}
+	selected, err := selectSteps(steps, state, options)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]StepResult, 0, len(steps))
+	save := func(current StepResult) error {
+		recorded := make([]StepResult, 0, len(steps))
+		for _, s := range steps {
+			if s.Name == current.Name {
+				recorded = append(recorded, current)
+			} else if r, ok := state[s.Name]; ok {
+				recorded = append(recorded, r)
+			}
+		}
+		state[current.Name] = current
+
+		// a fresh context records failures caused by the timeout of the run as well
+		saveCtx, cancel := context.WithTimeout(context.Background(), PIPELINE_SAVE_TIMEOUT)
+		defer cancel()
+		return savePipelineState(saveCtx, clientset, k8sConfig, pipeline, recorded)
+	}
+
+	for _, step := range steps {
+		if !selected[step.Name] {
+			results = append(results, StepResult{Name: step.Name, Status: STEP_SKIPPED})
+			continue
+		}
+
+		log.Printf("step %s\n", step.Name)
+		start := time.Now()
+		err := step.Run(ctx)
+		result := StepResult{
+			Name:     step.Name,
+			Status:   STEP_COMPLETED,
+			Duration: time.Since(start).Round(time.Millisecond).String(),
+		}
+		if err != nil {
+			result.Status = STEP_FAILED
+			result.Error = err.Error()
+		} else {
+			now := time.Now()
+			result.CompletedAt = &now
+		}
+		results = append(results, result)
+		log.Printf("step %s %s after %s\n", step.Name, result.Status, result.Duration)
+
+		saveErr := save(result)
+		if err != nil {
+			if saveErr != nil {
+				log.Printf("could not record state of step %s: %v\n", step.Name, saveErr)
+			}
+			return results, fmt.Errorf("step %s failed, continue with --resume: %w", step.Name, err)
+		}
+		if saveErr != nil {
+			return results, saveErr
+		}
+	}
+
+	return results, nil
+}
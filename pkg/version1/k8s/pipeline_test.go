@@ -0,0 +1,119 @@
+/*
+ * pipeline_test.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestSelectSteps(t *testing.T) {
+	steps := []Step{{Name: "genesis"}, {Name: "root"}, {Name: "validators"}, {Name: "ingress"}}
+	state := map[string]StepResult{
+		"genesis":    {Name: "genesis", Status: STEP_COMPLETED},
+		"root":       {Name: "root", Status: STEP_COMPLETED},
+		"validators": {Name: "validators", Status: STEP_FAILED},
+	}
+
+	tests := []struct {
+		name     string
+		state    map[string]StepResult
+		options  PipelineOptions
+		expected []string
+		err      bool
+	}{
+		{
+			name:     "fresh run",
+			options:  PipelineOptions{},
+			expected: []string{"genesis", "ingress", "root", "validators"},
+		},
+		{
+			name:     "resume skips completed steps",
+			state:    state,
+			options:  PipelineOptions{Resume: true},
+			expected: []string{"ingress", "validators"},
+		},
+		{
+			name:     "resume without state runs everything",
+			options:  PipelineOptions{Resume: true},
+			expected: []string{"genesis", "ingress", "root", "validators"},
+		},
+		{
+			name:     "resume and skip",
+			state:    state,
+			options:  PipelineOptions{Resume: true, Skip: []string{"ingress"}},
+			expected: []string{"validators"},
+		},
+		{
+			name:     "only reruns completed steps",
+			state:    state,
+			options:  PipelineOptions{Only: []string{"root", "ingress"}},
+			expected: []string{"ingress", "root"},
+		},
+		{
+			name:     "skip wins over only",
+			options:  PipelineOptions{Only: []string{"root", "ingress"}, Skip: []string{"root"}},
+			expected: []string{"ingress"},
+		},
+		{
+			name:    "unknown only step",
+			options: PipelineOptions{Only: []string{"nodes"}},
+			err:     true,
+		},
+		{
+			name:    "unknown skip step",
+			options: PipelineOptions{Skip: []string{"nodes"}},
+			err:     true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			selected, err := selectSteps(steps, test.state, test.options)
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected an error, selected %v", selected)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			names := []string{}
+			for name := range selected {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			if !reflect.DeepEqual(names, test.expected) {
+				t.Fatalf("expected %v, selected %v", test.expected, names)
+			}
+		})
+	}
+}
+
+func TestLoadsPipelineState(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  PipelineOptions
+		expected bool
+	}{
+		{name: "fresh run", options: PipelineOptions{}, expected: false},
+		{name: "skip", options: PipelineOptions{Skip: []string{"ingress"}}, expected: false},
+		{name: "resume", options: PipelineOptions{Resume: true}, expected: true},
+		{name: "only", options: PipelineOptions{Only: []string{"root"}}, expected: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if loadsPipelineState(test.options) != test.expected {
+				t.Fatalf("expected %v for %+v", test.expected, test.options)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+/*
+ * portforward.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+const (
+	HTTP_PORT            = 9650
+	PORT_FORWARD_ADDRESS = "127.0.0.1"
+)
+
+// PortForward forwards a free local port to a port of a pod and reconnects
+// when the connection to the pod is lost, e.g. because the pod restarted
+type PortForward struct {
+	restClient *rest.Config
+	Namespace  string
+	Pod        string
+	RemotePort int
+
+	mu sync.Mutex
+	// localPort is picked on the first connection and kept when reconnecting
+	localPort int
+	stopChan  chan struct{}
+	closed    chan struct{}
+}
+
+// ForwardPort opens a port forward to the pod and returns once the local port accepts connections
+func ForwardPort(ctx context.Context, restClient *rest.Config, namespace string, pod string, remotePort int) (*PortForward, error) {
+	p := &PortForward{
+		restClient: restClient,
+		Namespace:  namespace,
+		Pod:        pod,
+		RemotePort: remotePort,
+		closed:     make(chan struct{}),
+	}
+
+	done, err := p.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	go p.keepAlive(ctx, done)
+
+	return p, nil
+}
+
+// Endpoint is the http address of the forwarded port
+func (p *PortForward) Endpoint() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return fmt.Sprintf("http://%s:%d", PORT_FORWARD_ADDRESS, p.localPort)
+}
+
+func (p *PortForward) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	select {
+	case <-p.closed:
+		return
+	default:
+	}
+	close(p.closed)
+	close(p.stopChan)
+}
+
+func (p *PortForward) dialer() (httpstream.Dialer, error) {
+	roundTripper, upgrader, err := spdy.RoundTripperFor(p.restClient)
+	if err != nil {
+		return nil, err
+	}
+	clientset, err := kubernetes.NewForConfig(p.restClient)
+	if err != nil {
+		return nil, err
+	}
+
+	// let the rest client build the url so host paths and schemes of the api server are kept
+	serverURL := clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(p.Namespace).
+		Name(p.Pod).
+		SubResource("portforward").
+		URL()
+
+	return spdy.NewDialer(upgrader, &http.Client{Transport: roundTripper}, http.MethodPost, serverURL), nil
+}
+
+// connect establishes a single forwarding connection, the returned channel is closed when it ends
+func (p *PortForward) connect(ctx context.Context) (<-chan struct{}, error) {
+	dialer, err := p.dialer()
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	ports := []string{fmt.Sprintf("%d:%d", p.localPort, p.RemotePort)}
+	p.mu.Unlock()
+
+	stopChan, readyChan := make(chan struct{}), make(chan struct{})
+	forwarder, err := portforward.NewOnAddresses(dialer, []string{PORT_FORWARD_ADDRESS}, ports, stopChan, readyChan, io.Discard, io.Discard)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	errChan := make(chan error, 1)
+	go func() {
+		defer close(done)
+		errChan <- forwarder.ForwardPorts() // blocks until stopChan is closed or the connection is lost
+	}()
+
+	select {
+	case <-readyChan:
+	case err := <-errChan:
+		if err == nil {
+			err = fmt.Errorf("connection closed")
+		}
+		return nil, fmt.Errorf("could not forward port %d of %s: %w", p.RemotePort, p.Pod, err)
+	case <-ctx.Done():
+		close(stopChan)
+		return nil, ctx.Err()
+	}
+
+	forwarded, err := forwarder.GetPorts()
+	if err != nil {
+		close(stopChan)
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	select {
+	case <-p.closed:
+		close(stopChan)
+	default:
+		p.stopChan = stopChan
+		p.localPort = int(forwarded[0].Local)
+	}
+	return done, nil
+}
+
+func (p *PortForward) keepAlive(ctx context.Context, done <-chan struct{}) {
+	for {
+		select {
+		case <-p.closed:
+			return
+		case <-ctx.Done():
+			p.Close()
+			return
+		case <-done:
+		}
+
+		// the connection was lost without being closed, retry until the pod is back
+		for {
+			select {
+			case <-p.closed:
+				return
+			case <-ctx.Done():
+				p.Close()
+				return
+			case <-time.After(DEFAULT_TIMEOUT):
+			}
+
+			var err error
+			done, err = p.connect(ctx)
+			if err == nil {
+				break
+			}
+			log.Printf("reconnecting to %s: %v\n", p.Pod, err)
+		}
+	}
+}
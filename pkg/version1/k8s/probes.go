@@ -0,0 +1,58 @@
+/*
+ * probes.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"time"
+
+	"chain4travel.com/camktncr/pkg/version1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const PROBE_PERIOD = 10 * time.Second
+
+func probeCommand(check string) corev1.ProbeHandler {
+	return corev1.ProbeHandler{
+		Exec: &corev1.ExecAction{
+			Command: []string{"bash", "/mnt/scripts/probe.sh", check},
+		},
+	}
+}
+
+// failureThreshold converts a timeout into the number of failed probes that are tolerated
+func failureThreshold(timeout time.Duration) int32 {
+	threshold := int32(timeout / PROBE_PERIOD)
+	if threshold < 1 {
+		return 1
+	}
+	return threshold
+}
+
+// addProbes only marks nodes ready once all chains are bootstrapped, so the stateful set wait and
+// the services only consider bootstrapped nodes. Liveness is checked after startup succeeded
+func addProbes(container *corev1.Container, probe version1.K8sProbe) {
+	period := int32(PROBE_PERIOD / time.Second)
+
+	container.StartupProbe = &corev1.Probe{
+		ProbeHandler:     probeCommand("bootstrapped"),
+		PeriodSeconds:    period,
+		TimeoutSeconds:   period,
+		FailureThreshold: failureThreshold(probe.StartupTimeout),
+	}
+	container.ReadinessProbe = &corev1.Probe{
+		ProbeHandler:     probeCommand("bootstrapped"),
+		PeriodSeconds:    period,
+		TimeoutSeconds:   period,
+		FailureThreshold: 3,
+	}
+	container.LivenessProbe = &corev1.Probe{
+		ProbeHandler:     probeCommand("alive"),
+		PeriodSeconds:    period,
+		TimeoutSeconds:   period,
+		FailureThreshold: failureThreshold(probe.LivenessTimeout),
+	}
+}
@@ -0,0 +1,105 @@
+/*
+ * rpc.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+type RPCRequest struct {
+	JsonRPC string          `json:"jsonrpc"`
+	ID      int             `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+type RPCResponse struct {
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *RPCError       `json:"error,omitempty"`
+}
+
+// ChainPath maps the short name of a chain or api to its http path, P, X and C address
+// the chains, everything else is an api under /ext (info, health, admin, keystore, ...).
+// Paths starting with a slash are used as is
+func ChainPath(chain string) string {
+	switch {
+	case strings.HasPrefix(chain, "/"):
+		return chain
+	case chain == "C":
+		return "/ext/bc/C/rpc"
+	case chain == "P", chain == "X", strings.HasPrefix(chain, "C/"):
+		return fmt.Sprintf("/ext/bc/%s", chain)
+	default:
+		return fmt.Sprintf("/ext/%s", chain)
+	}
+}
+
+// CallRPC sends a json rpc request to the api of a node reachable under endpoint. Without params
+// the ethereum api of the C chain gets an empty list and all other apis an empty object
+func CallRPC(ctx context.Context, endpoint string, path string, method string, params json.RawMessage) (*RPCResponse, error) {
+	if len(params) == 0 {
+		params = json.RawMessage("{}")
+		if isEthereumPath(path) {
+			params = json.RawMessage("[]")
+		}
+	}
+	payload, err := json.Marshal(RPCRequest{
+		JsonRPC: "2.0",
+		ID:      1,
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+path, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", "application/json")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var out RPCResponse
+	err = json.Unmarshal(body, &out)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected response (%s): %s", res.Status, strings.TrimSpace(string(body)))
+	}
+	return &out, nil
+}
+
+// isEthereumPath tells if path is served by the ethereum json rpc of the C chain (also when
+// addressed by its blockchain id), which only takes positional params
+func isEthereumPath(path string) bool {
+	return strings.HasPrefix(path, "/ext/bc/") && strings.HasSuffix(path, "/rpc")
+}
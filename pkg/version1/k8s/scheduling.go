@@ -0,0 +1,77 @@
+/*
+ * scheduling.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"chain4travel.com/camktncr/pkg/version1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// spreadSelector selects all pods that should not share a node or zone with each other,
+// the root node counts as a validator
+func spreadSelector(options stateFullSetOptions) *metav1.LabelSelector {
+	sel := options.K8sConfig.Selector()
+	types := []string{options.Type}
+	if options.IsValidator {
+		types = []string{"root", "validator"}
+	}
+	sel.MatchExpressions = append(sel.MatchExpressions, metav1.LabelSelectorRequirement{
+		Key:      "type",
+		Operator: metav1.LabelSelectorOpIn,
+		Values:   types,
+	})
+	return sel
+}
+
+func applyScheduling(spec *corev1.PodSpec, options stateFullSetOptions) {
+	scheduling := options.Scheduling
+
+	spec.NodeSelector = scheduling.NodeSelector
+	spec.Tolerations = scheduling.Tolerations
+	if scheduling.Affinity != nil {
+		spec.Affinity = scheduling.Affinity.DeepCopy()
+	}
+	spec.TopologySpreadConstraints = append([]corev1.TopologySpreadConstraint{}, scheduling.TopologySpreadConstraints...)
+
+	switch scheduling.NodeSpread {
+	case version1.SPREAD_PREFERRED, version1.SPREAD_REQUIRED:
+		if spec.Affinity == nil {
+			spec.Affinity = &corev1.Affinity{}
+		}
+		if spec.Affinity.PodAntiAffinity == nil {
+			spec.Affinity.PodAntiAffinity = &corev1.PodAntiAffinity{}
+		}
+		term := corev1.PodAffinityTerm{
+			LabelSelector: spreadSelector(options),
+			TopologyKey:   corev1.LabelHostname,
+		}
+		antiAffinity := spec.Affinity.PodAntiAffinity
+		if scheduling.NodeSpread == version1.SPREAD_REQUIRED {
+			antiAffinity.RequiredDuringSchedulingIgnoredDuringExecution = append(antiAffinity.RequiredDuringSchedulingIgnoredDuringExecution, term)
+		} else {
+			antiAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(antiAffinity.PreferredDuringSchedulingIgnoredDuringExecution, corev1.WeightedPodAffinityTerm{
+				Weight:          100,
+				PodAffinityTerm: term,
+			})
+		}
+	}
+
+	switch scheduling.ZoneSpread {
+	case version1.SPREAD_PREFERRED, version1.SPREAD_REQUIRED:
+		whenUnsatisfiable := corev1.ScheduleAnyway
+		if scheduling.ZoneSpread == version1.SPREAD_REQUIRED {
+			whenUnsatisfiable = corev1.DoNotSchedule
+		}
+		spec.TopologySpreadConstraints = append(spec.TopologySpreadConstraints, corev1.TopologySpreadConstraint{
+			MaxSkew:           1,
+			TopologyKey:       corev1.LabelTopologyZone,
+			WhenUnsatisfiable: whenUnsatisfiable,
+			LabelSelector:     spreadSelector(options),
+		})
+	}
+}
@@ -0,0 +1,43 @@
+#!/bin/bash
+# usage: probe.sh bootstrapped|alive
+# camino-node images do not ship curl, requests are sent through bash's /dev/tcp
+set -e
+
+request() {
+    exec 3<>/dev/tcp/127.0.0.1/9650
+    printf "%s" "$1" >&3
+    RESPONSE=$(timeout 5 cat <&3)
+    exec 3>&-
+}
+
+post() {
+    request "$(printf "POST %s HTTP/1.1\r\nHost: localhost\r\nContent-Type: application/json\r\nContent-Length: %d\r\nConnection: close\r\n\r\n%s" "$1" "${#2}" "$2")"
+}
+
+case "$1" in
+    bootstrapped)
+        for CHAIN in P X C;
+        do
+            post /ext/info "{\"jsonrpc\":\"2.0\",\"id\":1,\"method\":\"info.isBootstrapped\",\"params\":{\"chain\":\"$CHAIN\"}}"
+            if [[ "$RESPONSE" != *'"isBootstrapped":true'* ]];
+            then
+                echo "$CHAIN chain is not bootstrapped"
+                exit 1
+            fi
+        done
+        ;;
+    alive)
+        # unhealthy nodes still answer with 503, only a node that does not answer at all is dead
+        request "$(printf "GET /ext/health HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")"
+        STATUS=$(echo "$RESPONSE" | head -n 1)
+        if [[ "$STATUS" != *" 200 "* ]] && [[ "$STATUS" != *" 503 "* ]];
+        then
+            echo "health endpoint answered with: $STATUS"
+            exit 1
+        fi
+        ;;
+    *)
+        echo "unknown probe $1"
+        exit 1
+        ;;
+esac
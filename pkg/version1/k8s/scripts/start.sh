@@ -1,31 +1,51 @@
 #!/bin/bash
 set -xe
 
-NETWORK_ID=kopernikus
+# NETWORK_ID is set from the genesis of the network
+: "${NETWORK_ID:?NETWORK_ID is not set}"
 
-HTTP_PARAMS="--http-host=0.0.0.0 --http-allowed-origins=* --http-port=9650"
-STAKING_PARAMS="--staking-tls-key-file=/mnt/cert/tls.key --staking-tls-cert-file=/mnt/cert/tls.crt --staking-port=9651"
-API_NODE_PARAMS="--index-enabled"
+PUBLIC_IP=$POD_IP
+STAKING_PORT=9651
 
-BOOTSTRAP_PARAMS="--api-admin-enabled=true --log-level=debug"
+# nodes with an exposed staking port announce their external address
+if [ -f "/mnt/p2p/$HOSTNAME.port" ];
+then
+    STAKING_PORT=$(cat /mnt/p2p/$HOSTNAME.port)
+    if [ -f "/mnt/p2p/$HOSTNAME.ip" ];
+    then
+        PUBLIC_IP=$(cat /mnt/p2p/$HOSTNAME.ip)
+    else
+        PUBLIC_IP=$HOST_IP
+    fi
+fi
+
+# the secret of the staker of this pod
+CERT_DIR=/mnt/cert
+
+# everything that is the same for all pods of a role is rendered into the node config map
+CONFIG_PARAMS="--config-file=/mnt/node-config/config.json"
+# camino-node fails on a chain config dir that does not exist, it is only mounted with chain configs
+if [ -d "/mnt/node-config/chains" ];
+then
+    CONFIG_PARAMS="$CONFIG_PARAMS --chain-config-dir=/mnt/node-config/chains"
+fi
+STAKING_PARAMS="--staking-tls-key-file=$CERT_DIR/tls.key --staking-tls-cert-file=$CERT_DIR/tls.crt --staking-port=$STAKING_PORT"
 
 # if [ ! -d "/mnt/data/$NETWORK_ID" ];
 # then 
 if [ "${IS_ROOT:-"false"}" = true ] && [ ! -d "/mnt/data/$NETWORK_ID" ];
 then 
-    BOOTSTRAP_PARAMS="$BOOTSTRAP_PARAMS --bootstrap-ids= --bootstrap-ips="
+    BOOTSTRAP_PARAMS="--bootstrap-ids= --bootstrap-ips="
 else 
     ROOT_PORT="${NETWORK_NAME^^}_ROOT_SERVICE_PORT_STAKING"
     ROOT_HOST="${NETWORK_NAME^^}_ROOT_SERVICE_HOST"
-    BOOTSTRAP_PARAMS="$BOOTSTRAP_PARAMS --bootstrap-ids=$ROOT_NODE_ID --bootstrap-ips=${!ROOT_HOST}:${!ROOT_PORT}"
+    BOOTSTRAP_PARAMS="--bootstrap-ids=$ROOT_NODE_ID --bootstrap-ips=${!ROOT_HOST}:${!ROOT_PORT}"
 fi
 # fi
 
-CMD="--network-id=$NETWORK_ID --public-ip=$POD_IP --db-dir=/mnt/data --genesis=/mnt/conf/genesis.json $BOOTSTRAP_PARAMS $HTTP_PARAMS"
-if [ "${IS_API_NODE:="false"}" = true ];
+CMD="--network-id=$NETWORK_ID --public-ip=$PUBLIC_IP $CONFIG_PARAMS $BOOTSTRAP_PARAMS"
+if [ "${IS_API_NODE:="false"}" != true ];
 then
-    CMD="$CMD $API_NODE_PARAMS"
-else
     CMD="$CMD $STAKING_PARAMS"
 fi
 
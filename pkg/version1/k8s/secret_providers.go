@@ -0,0 +1,170 @@
+/*
+ * secret_providers.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"chain4travel.com/camktncr/pkg/version1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	applyv1 "k8s.io/client-go/applyconfigurations/core/v1"
+	applymetav1 "k8s.io/client-go/applyconfigurations/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	SECRET_PROVIDER_KUBERNETES = "kubernetes"
+	SECRET_PROVIDER_VAULT      = "vault"
+)
+
+const (
+	PUBLIC_ADDRESS_KEY = "PublicAddress"
+	PRIVATE_KEY_KEY    = "PrivateKey"
+)
+
+// SecretProvider stores the certificates and keys of a staker under the name of its secret,
+// writing the same name again has to replace the stored data
+type SecretProvider interface {
+	WriteSecret(ctx context.Context, name string, data map[string][]byte) error
+}
+
+// stakerSecretData is everything a node needs to run with the staker, the private key
+// is only used to register the validators
+func stakerSecretData(s version1.Staker, excludePrivateKey bool) map[string][]byte {
+	data := map[string][]byte{
+		corev1.TLSCertKey:       s.CertBytes,
+		corev1.TLSPrivateKeyKey: s.KeyBytes,
+		NODE_ID_KEY:             []byte(s.NodeID.String()),
+		PUBLIC_ADDRESS_KEY:      []byte(s.PublicAddress),
+	}
+	if !excludePrivateKey {
+		data[PRIVATE_KEY_KEY] = []byte(s.PrivateKey)
+	}
+	return data
+}
+
+type kubernetesSecretProvider struct {
+	clientset *kubernetes.Clientset
+	k8sConfig version1.K8sConfig
+}
+
+// NewKubernetesSecretProvider writes the staker secrets directly into the namespace of the network
+func NewKubernetesSecretProvider(clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig) SecretProvider {
+	return &kubernetesSecretProvider{clientset: clientset, k8sConfig: k8sConfig}
+}
+
+func (p *kubernetesSecretProvider) WriteSecret(ctx context.Context, name string, data map[string][]byte) error {
+	secretType := corev1.SecretTypeTLS
+	kind := "Secret"
+	version := "v1"
+
+	secret := &applyv1.SecretApplyConfiguration{
+		TypeMetaApplyConfiguration: applymetav1.TypeMetaApplyConfiguration{
+			Kind:       &kind,
+			APIVersion: &version,
+		},
+		ObjectMetaApplyConfiguration: &applymetav1.ObjectMetaApplyConfiguration{
+			Name:      &name,
+			Namespace: &p.k8sConfig.Namespace,
+			Labels:    p.k8sConfig.Labels,
+		},
+		Data: data,
+		Type: &secretType,
+	}
+
+	_, err := p.clientset.CoreV1().Secrets(p.k8sConfig.Namespace).Apply(ctx, secret, metav1.ApplyOptions{
+		Force:        true,
+		FieldManager: FIELD_MANAGER_STRING,
+	})
+	return err
+}
+
+type vaultSecretProvider struct {
+	address string
+	token   string
+	mount   string
+	path    string
+}
+
+// NewVaultSecretProvider writes the staker secrets to <mount>/data/<path>/<name> of a KV v2 secrets engine
+func NewVaultSecretProvider(address string, token string, mount string, path string) SecretProvider {
+	return &vaultSecretProvider{
+		address: strings.TrimSuffix(address, "/"),
+		token:   token,
+		mount:   strings.Trim(mount, "/"),
+		path:    strings.Trim(path, "/"),
+	}
+}
+
+func (p *vaultSecretProvider) WriteSecret(ctx context.Context, name string, data map[string][]byte) error {
+	// kv stores strings, all values are pem or plain text
+	values := make(map[string]string, len(data))
+	for k, v := range data {
+		values[k] = string(v)
+	}
+	payload, err := json.Marshal(map[string]interface{}{"data": values})
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/v1/%s/data/%s", p.address, p.mount, path.Join(p.path, name))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("X-Vault-Token", p.token)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusNoContent {
+		body, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("vault returned %s for %s: %s", res.Status, url, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+type fileSecretProvider struct {
+	dir string
+}
+
+// NewFileSecretProvider writes every staker secret as <dir>/<name>.json, it is meant for tests,
+// nodes cannot read these secrets
+func NewFileSecretProvider(dir string) SecretProvider {
+	return &fileSecretProvider{dir: dir}
+}
+
+func (p *fileSecretProvider) WriteSecret(ctx context.Context, name string, data map[string][]byte) error {
+	values := make(map[string]string, len(data))
+	for k, v := range data {
+		values[k] = string(v)
+	}
+	content, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(p.dir, 0700)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(p.dir, name+".json"), content, 0600)
+}
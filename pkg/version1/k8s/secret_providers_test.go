@@ -0,0 +1,147 @@
+/*
+ * secret_providers_test.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"chain4travel.com/camktncr/pkg/version1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func testStakers() []version1.Staker {
+	return []version1.Staker{
+		{CertBytes: []byte("cert-0"), KeyBytes: []byte("key-0"), PrivateKey: "private-0", PublicAddress: "address-0"},
+		{CertBytes: []byte("cert-1"), KeyBytes: []byte("key-1"), PrivateKey: "private-1", PublicAddress: "address-1"},
+	}
+}
+
+func readSecretFile(t *testing.T, dir string, name string) map[string]string {
+	t.Helper()
+
+	path := filepath.Join(dir, name+".json")
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("%s has mode %v, expected 0600", path, info.Mode().Perm())
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]string{}
+	err = json.Unmarshal(raw, &values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return values
+}
+
+func TestStakerSecretData(t *testing.T) {
+	s := testStakers()[0]
+
+	tests := []struct {
+		name              string
+		excludePrivateKey bool
+		expected          map[string]string
+	}{
+		{
+			name: "with private key",
+			expected: map[string]string{
+				corev1.TLSCertKey:       "cert-0",
+				corev1.TLSPrivateKeyKey: "key-0",
+				NODE_ID_KEY:             s.NodeID.String(),
+				PUBLIC_ADDRESS_KEY:      "address-0",
+				PRIVATE_KEY_KEY:         "private-0",
+			},
+		},
+		{
+			name:              "without private key",
+			excludePrivateKey: true,
+			expected: map[string]string{
+				corev1.TLSCertKey:       "cert-0",
+				corev1.TLSPrivateKeyKey: "key-0",
+				NODE_ID_KEY:             s.NodeID.String(),
+				PUBLIC_ADDRESS_KEY:      "address-0",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := stakerSecretData(s, test.excludePrivateKey)
+			if len(data) != len(test.expected) {
+				t.Fatalf("expected %d keys, got %d", len(test.expected), len(data))
+			}
+			for k, v := range test.expected {
+				got, ok := data[k]
+				if !ok {
+					t.Fatalf("missing key %s", k)
+				}
+				if string(got) != v {
+					t.Fatalf("expected %s for %s, got %s", v, k, got)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateStakerSecrets(t *testing.T) {
+	tests := []struct {
+		name               string
+		excludePrivateKeys bool
+	}{
+		{name: "with private keys"},
+		{name: "without private keys", excludePrivateKeys: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			k8sConfig := version1.K8sConfig{
+				K8sPrefix: "test",
+				Namespace: "test",
+				StakerSecrets: version1.K8sStakerSecrets{
+					ExcludePrivateKeys: test.excludePrivateKeys,
+				},
+			}
+
+			// the clients are only used to sync from an external secret store
+			stakers := testStakers()
+			err := CreateStakerSecrets(context.Background(), nil, nil, NewFileSecretProvider(dir), stakers, k8sConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, s := range stakers {
+				name := fmt.Sprintf("test-%d", i)
+				values := readSecretFile(t, dir, name)
+				if values[corev1.TLSCertKey] != string(s.CertBytes) || values[corev1.TLSPrivateKeyKey] != string(s.KeyBytes) {
+					t.Fatalf("%s does not contain the certificate of staker %d", name, i)
+				}
+				if values[PUBLIC_ADDRESS_KEY] != s.PublicAddress {
+					t.Fatalf("%s does not contain the address of staker %d", name, i)
+				}
+				privateKey, ok := values[PRIVATE_KEY_KEY]
+				if ok == test.excludePrivateKeys {
+					t.Fatalf("%s contains the private key: %v, expected %v", name, ok, !test.excludePrivateKeys)
+				}
+				if ok && privateKey != s.PrivateKey {
+					t.Fatalf("%s does not contain the private key of staker %d", name, i)
+				}
+			}
+		})
+	}
+}
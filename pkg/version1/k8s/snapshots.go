@@ -0,0 +1,652 @@
+/*
+ * snapshots.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"chain4travel.com/camktncr/pkg/version1"
+	"github.com/ava-labs/avalanchego/genesis"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const SNAPSHOT_LABEL = "camktncr-snapshot"
+const SNAPSHOT_READY_TIMEOUT = 30 * time.Minute
+const DEFAULT_SNAPSHOT_NAMESPACE = "camktncr-snapshots"
+
+var volumeSnapshotResource = schema.GroupVersionResource{Group: "snapshot.storage.k8s.io", Version: "v1", Resource: "volumesnapshots"}
+var volumeSnapshotContentResource = schema.GroupVersionResource{Group: "snapshot.storage.k8s.io", Version: "v1", Resource: "volumesnapshotcontents"}
+
+// snapshotClaim records a data volume claim and the volume snapshot taken of it
+type snapshotClaim struct {
+	Claim        string
+	Snapshot     string
+	Type         string
+	Size         resource.Quantity
+	StorageClass *string
+	AccessModes  []corev1.PersistentVolumeAccessMode
+}
+
+// snapshotManifest is stored next to the volume snapshots and contains everything besides the
+// volumes that is needed to start a network from them
+type snapshotManifest struct {
+	Network string
+	Prefix  string
+	Genesis []byte
+	Stakers []map[string][]byte
+	Claims  []snapshotClaim
+}
+
+func snapshotManifestName(snapshotName string) string {
+	return fmt.Sprintf("%s-snapshot", snapshotName)
+}
+
+// stakerSecrets returns the staker secrets of the network ordered by their index
+func stakerSecrets(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig) ([]corev1.Secret, error) {
+	selector, err := metav1.LabelSelectorAsSelector(k8sConfig.Selector())
+	if err != nil {
+		return nil, err
+	}
+	secrets, err := clientset.CoreV1().Secrets(k8sConfig.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: selector.String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	pattern := regexp.MustCompile(fmt.Sprintf(`^%s-(\d+)$`, regexp.QuoteMeta(k8sConfig.K8sPrefix)))
+	byIndex := map[int]corev1.Secret{}
+	for _, s := range secrets.Items {
+		match := pattern.FindStringSubmatch(s.Name)
+		if match == nil {
+			continue
+		}
+		index, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid staker secret %s: %w", s.Name, err)
+		}
+		byIndex[index] = s
+	}
+
+	if len(byIndex) == 0 {
+		return nil, fmt.Errorf("network %s has no staker secrets %s-<n>", k8sConfig.K8sPrefix, k8sConfig.K8sPrefix)
+	}
+
+	out := make([]corev1.Secret, 0, len(byIndex))
+	for i := 0; i < len(byIndex); i++ {
+		s, ok := byIndex[i]
+		if !ok {
+			return nil, fmt.Errorf("staker secret %s-%d is missing", k8sConfig.K8sPrefix, i)
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+func waitForSnapshotReady(ctx context.Context, client dynamic.NamespaceableResourceInterface, namespace string, name string) (*unstructured.Unstructured, error) {
+	ctx, cancel := context.WithTimeout(ctx, SNAPSHOT_READY_TIMEOUT)
+	defer cancel()
+
+	for {
+		snapshot, err := client.Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+
+		ready, _, _ := unstructured.NestedBool(snapshot.Object, "status", "readyToUse")
+		if ready {
+			return snapshot, nil
+		}
+		message, found, _ := unstructured.NestedString(snapshot.Object, "status", "error", "message")
+		if found {
+			return nil, fmt.Errorf("snapshot %s failed: %s", name, message)
+		}
+
+		log.Printf("waiting for snapshot %s to become ready\n", name)
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("snapshot %s did not become ready: %w", name, ctx.Err())
+		case <-time.After(DEFAULT_TIMEOUT):
+		}
+	}
+}
+
+func ensureSnapshotNamespace(ctx context.Context, clientset *kubernetes.Clientset, namespace string) error {
+	ns := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: namespace,
+		},
+	}
+	_, err := clientset.CoreV1().Namespaces().Create(ctx, ns, metav1.CreateOptions{
+		FieldManager: FIELD_MANAGER_STRING,
+	})
+	if err != nil && !k8sErrors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+// CreateSnapshot takes a csi volume snapshot of every data volume of the network and stores the
+// genesis and staker secrets alongside. Volume snapshots can only be taken in the namespace of the
+// claim, they are moved to snapshotNamespace afterwards so the snapshot survives destroying the
+// network together with its namespace
+func CreateSnapshot(ctx context.Context, restClient *rest.Config, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig, snapshotName string, snapshotClass string, snapshotNamespace string) error {
+	err := requireVolumeSnapshots(restClient)
+	if err != nil {
+		return err
+	}
+
+	err = ensureSnapshotNamespace(ctx, clientset, snapshotNamespace)
+	if err != nil {
+		return err
+	}
+
+	dynClient, err := dynamic.NewForConfig(restClient)
+	if err != nil {
+		return err
+	}
+
+	// the cleanup of a failed snapshot must not touch the volume snapshots of an existing one
+	_, err = clientset.CoreV1().Secrets(snapshotNamespace).Get(ctx, snapshotManifestName(snapshotName), metav1.GetOptions{})
+	if err == nil {
+		return fmt.Errorf("snapshot %s already exists in %s", snapshotName, snapshotNamespace)
+	}
+	if !k8sErrors.IsNotFound(err) {
+		return err
+	}
+
+	created := []string{}
+	err = snapshotNetwork(ctx, clientset, dynClient, k8sConfig, snapshotName, snapshotClass, snapshotNamespace, &created)
+	if err == nil || len(created) == 0 {
+		return err
+	}
+
+	// the context may be the reason of the failure, the cleanup must run anyway
+	leftovers := deleteVolumeSnapshots(context.Background(), dynClient, k8sConfig.Namespace, snapshotNamespace, created)
+	if len(leftovers) > 0 {
+		return fmt.Errorf("%w, could not remove the volume snapshots %s", err, strings.Join(leftovers, ", "))
+	}
+	return err
+}
+
+// snapshotNetwork does the work of CreateSnapshot and records the name of every volume snapshot it
+// created in created, so that they can be removed if a later one fails
+func snapshotNetwork(ctx context.Context, clientset *kubernetes.Clientset, dynClient dynamic.Interface, k8sConfig version1.K8sConfig, snapshotName string, snapshotClass string, snapshotNamespace string, created *[]string) error {
+	snapshotClient := dynClient.Resource(volumeSnapshotResource)
+
+	genesisCm, err := clientset.CoreV1().ConfigMaps(k8sConfig.Namespace).Get(ctx, k8sConfig.K8sPrefix, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("could not read genesis of %s: %w", k8sConfig.K8sPrefix, err)
+	}
+
+	secrets, err := stakerSecrets(ctx, clientset, k8sConfig)
+	if err != nil {
+		return err
+	}
+
+	manifest := snapshotManifest{
+		Network: k8sConfig.Namespace,
+		Prefix:  k8sConfig.K8sPrefix,
+		Genesis: genesisCm.BinaryData["genesis.json"],
+		Stakers: make([]map[string][]byte, len(secrets)),
+		Claims:  make([]snapshotClaim, 0),
+	}
+	for i, s := range secrets {
+		manifest.Stakers[i] = s.Data
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(k8sConfig.Selector())
+	if err != nil {
+		return err
+	}
+	claims, err := clientset.CoreV1().PersistentVolumeClaims(k8sConfig.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: selector.String(),
+	})
+	if err != nil {
+		return err
+	}
+
+	snapshotLabels := map[string]string{SNAPSHOT_LABEL: snapshotName}
+
+	for _, claim := range claims.Items {
+		if !strings.HasPrefix(claim.Name, DATA_VOLUME_NAME+"-") {
+			continue
+		}
+
+		name := fmt.Sprintf("%s-%s", snapshotName, claim.Name)
+		spec := map[string]interface{}{
+			"source": map[string]interface{}{
+				"persistentVolumeClaimName": claim.Name,
+			},
+		}
+		if snapshotClass != "" {
+			spec["volumeSnapshotClassName"] = snapshotClass
+		}
+
+		snapshot := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "snapshot.storage.k8s.io/v1",
+			"kind":       "VolumeSnapshot",
+			"metadata": map[string]interface{}{
+				"name":      name,
+				"namespace": k8sConfig.Namespace,
+				"labels":    map[string]interface{}{SNAPSHOT_LABEL: snapshotName},
+			},
+			"spec": spec,
+		}}
+
+		_, err := snapshotClient.Namespace(k8sConfig.Namespace).Create(ctx, snapshot, metav1.CreateOptions{
+			FieldManager: FIELD_MANAGER_STRING,
+		})
+		if err != nil {
+			return fmt.Errorf("could not snapshot %s: %w", claim.Name, err)
+		}
+		*created = append(*created, name)
+		log.Printf("created snapshot %s of %s\n", name, claim.Name)
+
+		manifest.Claims = append(manifest.Claims, snapshotClaim{
+			Claim:        claim.Name,
+			Snapshot:     name,
+			Type:         claim.Labels["type"],
+			Size:         claim.Spec.Resources.Requests[corev1.ResourceStorage],
+			StorageClass: claim.Spec.StorageClassName,
+			AccessModes:  claim.Spec.AccessModes,
+		})
+	}
+
+	if len(manifest.Claims) == 0 {
+		return fmt.Errorf("network %s has no data volumes to snapshot", k8sConfig.K8sPrefix)
+	}
+
+	for _, c := range manifest.Claims {
+		err := moveSnapshot(ctx, dynClient, k8sConfig.Namespace, c.Snapshot, snapshotNamespace, snapshotName)
+		if err != nil {
+			return err
+		}
+	}
+
+	manifestJson, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      snapshotManifestName(snapshotName),
+			Namespace: snapshotNamespace,
+			Labels:    snapshotLabels,
+		},
+		Data: map[string][]byte{
+			"manifest.json": manifestJson,
+		},
+	}
+	_, err = clientset.CoreV1().Secrets(snapshotNamespace).Create(ctx, secret, metav1.CreateOptions{
+		FieldManager: FIELD_MANAGER_STRING,
+	})
+	return err
+}
+
+// deleteVolumeSnapshots removes the volume snapshots of a failed CreateSnapshot from the namespace of
+// the network and, if they were moved already, from snapshotNamespace together with their storage
+// snapshots. It returns the snapshots it could not remove
+func deleteVolumeSnapshots(ctx context.Context, dynClient dynamic.Interface, namespace string, snapshotNamespace string, names []string) []string {
+	leftovers := []string{}
+	for _, name := range names {
+		for _, ns := range []string{snapshotNamespace, namespace} {
+			err := deleteVolumeSnapshot(ctx, dynClient, ns, name)
+			if err != nil {
+				log.Printf("could not remove snapshot %s/%s: %v\n", ns, name, err)
+				leftovers = append(leftovers, fmt.Sprintf("%s/%s", ns, name))
+			}
+		}
+
+		// a move that failed before the snapshot was bound leaves its content behind
+		err := dynClient.Resource(volumeSnapshotContentResource).Delete(ctx, fmt.Sprintf("%s-%s", snapshotNamespace, name), metav1.DeleteOptions{})
+		if err != nil && !k8sErrors.IsNotFound(err) {
+			log.Printf("could not remove snapshot content %s-%s: %v\n", snapshotNamespace, name, err)
+			leftovers = append(leftovers, fmt.Sprintf("%s-%s", snapshotNamespace, name))
+		}
+	}
+	return leftovers
+}
+
+// deleteVolumeSnapshot removes a snapshot together with its storage snapshot, the content of a
+// snapshot that was being moved retains the storage snapshot and is switched back first
+func deleteVolumeSnapshot(ctx context.Context, dynClient dynamic.Interface, namespace string, name string) error {
+	snapshotClient := dynClient.Resource(volumeSnapshotResource).Namespace(namespace)
+	snapshot, err := snapshotClient.Get(ctx, name, metav1.GetOptions{})
+	if k8sErrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	contentName, _, _ := unstructured.NestedString(snapshot.Object, "status", "boundVolumeSnapshotContentName")
+	if contentName != "" {
+		remove := []byte(`{"spec":{"deletionPolicy":"Delete"}}`)
+		_, err = dynClient.Resource(volumeSnapshotContentResource).Patch(ctx, contentName, types.MergePatchType, remove, metav1.PatchOptions{FieldManager: FIELD_MANAGER_STRING})
+		if err != nil && !k8sErrors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	err = snapshotClient.Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+func loadSnapshotManifest(ctx context.Context, clientset *kubernetes.Clientset, snapshotName string, snapshotNamespace string) (*snapshotManifest, error) {
+	secret, err := clientset.CoreV1().Secrets(snapshotNamespace).Get(ctx, snapshotManifestName(snapshotName), metav1.GetOptions{})
+	if k8sErrors.IsNotFound(err) {
+		return nil, fmt.Errorf("snapshot %s not found in %s", snapshotName, snapshotNamespace)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest snapshotManifest
+	err = json.Unmarshal(secret.Data["manifest.json"], &manifest)
+	if err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+// snapshotStorage waits for the snapshot and returns its content together with the csi driver
+// and handle of the storage snapshot
+func snapshotStorage(ctx context.Context, dynClient dynamic.Interface, namespace string, name string) (string, string, string, error) {
+	source, err := waitForSnapshotReady(ctx, dynClient.Resource(volumeSnapshotResource), namespace, name)
+	if err != nil {
+		return "", "", "", err
+	}
+	contentName, _, _ := unstructured.NestedString(source.Object, "status", "boundVolumeSnapshotContentName")
+	content, err := dynClient.Resource(volumeSnapshotContentResource).Get(ctx, contentName, metav1.GetOptions{})
+	if err != nil {
+		return "", "", "", err
+	}
+	driver, _, _ := unstructured.NestedString(content.Object, "spec", "driver")
+	handle, _, _ := unstructured.NestedString(content.Object, "status", "snapshotHandle")
+	if handle == "" {
+		return "", "", "", fmt.Errorf("snapshot content %s has no snapshot handle", contentName)
+	}
+	return contentName, driver, handle, nil
+}
+
+// bindSnapshot creates a snapshot in namespace for an existing storage snapshot through a
+// pre-provisioned snapshot content, deletionPolicy decides if the storage snapshot is removed with it
+func bindSnapshot(ctx context.Context, dynClient dynamic.Interface, driver string, handle string, namespace string, name string, labels map[string]interface{}, deletionPolicy string) error {
+	contentName := fmt.Sprintf("%s-%s", namespace, name)
+	content := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "snapshot.storage.k8s.io/v1",
+		"kind":       "VolumeSnapshotContent",
+		"metadata": map[string]interface{}{
+			"name":   contentName,
+			"labels": labels,
+		},
+		"spec": map[string]interface{}{
+			"deletionPolicy": deletionPolicy,
+			"driver":         driver,
+			"source": map[string]interface{}{
+				"snapshotHandle": handle,
+			},
+			"volumeSnapshotRef": map[string]interface{}{
+				"name":      name,
+				"namespace": namespace,
+			},
+		},
+	}}
+	_, err := dynClient.Resource(volumeSnapshotContentResource).Create(ctx, content, metav1.CreateOptions{FieldManager: FIELD_MANAGER_STRING})
+	if err != nil && !k8sErrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	snapshot := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "snapshot.storage.k8s.io/v1",
+		"kind":       "VolumeSnapshot",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": namespace,
+			"labels":    labels,
+		},
+		"spec": map[string]interface{}{
+			"source": map[string]interface{}{
+				"volumeSnapshotContentName": contentName,
+			},
+		},
+	}}
+	_, err = dynClient.Resource(volumeSnapshotResource).Namespace(namespace).Create(ctx, snapshot, metav1.CreateOptions{FieldManager: FIELD_MANAGER_STRING})
+	if err != nil && !k8sErrors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+// moveSnapshot hands the storage snapshot of a snapshot in the network namespace over to a new
+// snapshot in snapshotNamespace, which then owns it, and removes the original snapshot
+func moveSnapshot(ctx context.Context, dynClient dynamic.Interface, namespace string, name string, snapshotNamespace string, snapshotName string) error {
+	contentName, driver, handle, err := snapshotStorage(ctx, dynClient, namespace, name)
+	if err != nil {
+		return err
+	}
+
+	// the storage snapshot must outlive the original snapshot and its content
+	contentClient := dynClient.Resource(volumeSnapshotContentResource)
+	retain := []byte(`{"spec":{"deletionPolicy":"Retain"}}`)
+	_, err = contentClient.Patch(ctx, contentName, types.MergePatchType, retain, metav1.PatchOptions{FieldManager: FIELD_MANAGER_STRING})
+	if err != nil {
+		return err
+	}
+
+	labels := map[string]interface{}{SNAPSHOT_LABEL: snapshotName}
+	err = bindSnapshot(ctx, dynClient, driver, handle, snapshotNamespace, name, labels, "Delete")
+	if err != nil {
+		return err
+	}
+	_, err = waitForSnapshotReady(ctx, dynClient.Resource(volumeSnapshotResource), snapshotNamespace, name)
+	if err != nil {
+		return err
+	}
+
+	err = dynClient.Resource(volumeSnapshotResource).Namespace(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		return err
+	}
+	err = contentClient.Delete(ctx, contentName, metav1.DeleteOptions{})
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		return err
+	}
+	log.Printf("moved snapshot %s to %s\n", name, snapshotNamespace)
+	return nil
+}
+
+// importSnapshot makes a snapshot of the snapshot namespace usable in the namespace of the network.
+// The storage snapshot stays owned by the snapshot it is imported from
+func importSnapshot(ctx context.Context, dynClient dynamic.Interface, snapshotNamespace string, sourceName string, k8sConfig version1.K8sConfig, name string) error {
+	_, driver, handle, err := snapshotStorage(ctx, dynClient, snapshotNamespace, sourceName)
+	if err != nil {
+		return err
+	}
+
+	labels := map[string]interface{}{}
+	for k, v := range k8sConfig.Labels {
+		labels[k] = v
+	}
+	return bindSnapshot(ctx, dynClient, driver, handle, k8sConfig.Namespace, name, labels, "Retain")
+}
+
+// RestoreSnapshot provisions the data volumes, genesis and staker secrets of a new network from a snapshot.
+// The claims are named like the stateful sets expect them, so `k8s create --reuse-genesis` picks them up.
+// It returns the name of the network the snapshot was taken from
+func RestoreSnapshot(ctx context.Context, restClient *rest.Config, clientset *kubernetes.Clientset, provider SecretProvider, snapshotName string, snapshotNamespace string, k8sConfig version1.K8sConfig) (string, error) {
+	err := requireVolumeSnapshots(restClient)
+	if err != nil {
+		return "", err
+	}
+
+	manifest, err := loadSnapshotManifest(ctx, clientset, snapshotName, snapshotNamespace)
+	if err != nil {
+		return "", err
+	}
+
+	dynClient, err := dynamic.NewForConfig(restClient)
+	if err != nil {
+		return "", err
+	}
+
+	err = CreateNamespace(ctx, clientset, k8sConfig, false)
+	if err != nil {
+		return "", err
+	}
+
+	var genesisConfig genesis.UnparsedConfig
+	err = json.Unmarshal(manifest.Genesis, &genesisConfig)
+	if err != nil {
+		return "", err
+	}
+	err = CreateNetworkConfigMap(ctx, clientset, genesisConfig, k8sConfig)
+	if err != nil {
+		return "", err
+	}
+
+	// the staker secrets go through the provider of the new network like the ones of create
+	stakerData := make([]map[string][]byte, len(manifest.Stakers))
+	for i, data := range manifest.Stakers {
+		stakerData[i] = make(map[string][]byte, len(data))
+		for k, v := range data {
+			if k == PRIVATE_KEY_KEY && k8sConfig.StakerSecrets.ExcludePrivateKeys {
+				continue
+			}
+			stakerData[i][k] = v
+		}
+	}
+	err = writeStakerSecrets(ctx, restClient, clientset, provider, stakerData, k8sConfig)
+	if err != nil {
+		return "", err
+	}
+
+	oldClaimPrefix := fmt.Sprintf("%s-%s-", DATA_VOLUME_NAME, manifest.Prefix)
+	newClaimPrefix := fmt.Sprintf("%s-%s-", DATA_VOLUME_NAME, k8sConfig.K8sPrefix)
+	apiGroup := "snapshot.storage.k8s.io"
+
+	for _, c := range manifest.Claims {
+		claimName := newClaimPrefix + strings.TrimPrefix(c.Claim, oldClaimPrefix)
+		snapshotName := fmt.Sprintf("restore-%s", claimName)
+
+		err := importSnapshot(ctx, dynClient, snapshotNamespace, c.Snapshot, k8sConfig, snapshotName)
+		if err != nil {
+			return "", err
+		}
+
+		labels := map[string]string{}
+		for k, v := range k8sConfig.Labels {
+			labels[k] = v
+		}
+		labels["type"] = c.Type
+
+		claim := &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      claimName,
+				Namespace: k8sConfig.Namespace,
+				Labels:    labels,
+			},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				AccessModes:      c.AccessModes,
+				StorageClassName: c.StorageClass,
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceStorage: c.Size,
+					},
+				},
+				DataSource: &corev1.TypedLocalObjectReference{
+					APIGroup: &apiGroup,
+					Kind:     "VolumeSnapshot",
+					Name:     snapshotName,
+				},
+			},
+		}
+		_, err = clientset.CoreV1().PersistentVolumeClaims(k8sConfig.Namespace).Create(ctx, claim, metav1.CreateOptions{
+			FieldManager: FIELD_MANAGER_STRING,
+		})
+		if err != nil {
+			return "", fmt.Errorf("could not restore %s: %w", claimName, err)
+		}
+		log.Printf("restored %s from %s\n", claimName, c.Snapshot)
+	}
+
+	return manifest.Network, nil
+}
+
+// deleteRestoredSnapshots removes the snapshots a network was restored from, the storage snapshots
+// themselves are retained as they belong to the snapshot of the source network
+func deleteRestoredSnapshots(ctx context.Context, restClient *rest.Config, namespace string, selector string) error {
+	dynClient, err := dynamic.NewForConfig(restClient)
+	if err != nil {
+		return err
+	}
+
+	listOptions := metav1.ListOptions{LabelSelector: selector}
+	snapshots, err := dynClient.Resource(volumeSnapshotResource).Namespace(namespace).List(ctx, listOptions)
+	if err != nil {
+		return err
+	}
+	for _, s := range snapshots.Items {
+		err := dynClient.Resource(volumeSnapshotResource).Namespace(namespace).Delete(ctx, s.GetName(), metav1.DeleteOptions{})
+		if err != nil && !k8sErrors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	err = dynClient.Resource(volumeSnapshotContentResource).DeleteCollection(ctx, metav1.DeleteOptions{}, listOptions)
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+func requireVolumeSnapshots(restClient *rest.Config) error {
+	caps, err := DiscoverCapabilities(restClient)
+	if err != nil {
+		return err
+	}
+	if !caps.VolumeSnapshots {
+		return fmt.Errorf("the cluster does not serve %s, install the csi snapshot crds and controller", volumeSnapshotResource.GroupResource())
+	}
+	return nil
+}
+
+// GetNetworkGenesis reads the genesis of an existing network from the cluster
+func GetNetworkGenesis(ctx context.Context, clientset *kubernetes.Clientset, k8sConfig version1.K8sConfig) (*genesis.UnparsedConfig, error) {
+	cm, err := clientset.CoreV1().ConfigMaps(k8sConfig.Namespace).Get(ctx, k8sConfig.K8sPrefix, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var genesisConfig genesis.UnparsedConfig
+	err = json.Unmarshal(cm.BinaryData["genesis.json"], &genesisConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &genesisConfig, nil
+}
@@ -16,7 +16,7 @@ import (
 	promVersioned "github.com/prometheus-operator/prometheus-operator/pkg/client/versioned"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/resource"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/kubernetes"
@@ -28,108 +28,356 @@ func buildService(options stateFullSetOptions) corev1.Service {
 	servicePorts := []corev1.ServicePort{
 		{Name: "rpc", Port: 9650, TargetPort: intstr.FromInt(9650)},
 	}
-	if options.IsValidator {
+	if options.hasStakingContainerPort() {
 		servicePorts = append(servicePorts,
-			corev1.ServicePort{Name: "staking", Port: 9651, TargetPort: intstr.FromInt(9651)})
+			corev1.ServicePort{Name: "staking", Port: STAKING_PORT, TargetPort: intstr.FromString("staking")})
 	}
 
 	return corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      options.Name(),
 			Namespace: options.Namespace,
-			Labels:    options.K8sConfig.Labels,
+			Labels:    options.Labels(),
 		},
 		Spec: corev1.ServiceSpec{
 			Type:  corev1.ServiceTypeClusterIP,
 			Ports: servicePorts,
+			// validators need to reach peers that are still bootstrapping
+			PublishNotReadyAddresses: options.IsValidator,
 
 			Selector: options.Labels(),
 		},
 	}
 }
 
-func createStatefulSetWithOptions(ctx context.Context, restClient *rest.Config, clientset *kubernetes.Clientset, options stateFullSetOptions) error {
-	svc := buildService(options)
+// buildNodeService builds a service that only selects the pod with the given ordinal,
+// so that single nodes can be addressed through the ingress
+func buildNodeService(options stateFullSetOptions, ordinal int32) corev1.Service {
+	podName := options.PodName(ordinal)
 
-	serviceClient := clientset.CoreV1().Services(options.Namespace)
-	_, foundErr := serviceClient.Get(ctx, options.Name(), metav1.GetOptions{})
+	labels := options.Labels()
+	labels[NODE_ROUTE_LABEL] = "true"
+
+	selector := options.Labels()
+	selector[appsv1.StatefulSetPodNameLabel] = podName
+
+	return corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      podName,
+			Namespace: options.Namespace,
+			Labels:    labels,
+		},
+		Spec: corev1.ServiceSpec{
+			Type: corev1.ServiceTypeClusterIP,
+			Ports: []corev1.ServicePort{
+				{Name: "rpc", Port: 9650, TargetPort: intstr.FromInt(9650)},
+			},
+			// single nodes are mostly looked at while they are not healthy
+			PublishNotReadyAddresses: true,
+			Selector:                 selector,
+		},
+	}
+}
+
+func createOrUpdateService(ctx context.Context, clientset *kubernetes.Clientset, svc corev1.Service) error {
+	serviceClient := clientset.CoreV1().Services(svc.Namespace)
+	found, foundErr := serviceClient.Get(ctx, svc.Name, metav1.GetOptions{})
 	if foundErr == nil {
+		svc.ResourceVersion = found.ResourceVersion
+		svc.Spec.ClusterIP = found.Spec.ClusterIP
 		_, err := serviceClient.Update(ctx, &svc, metav1.UpdateOptions{
 			FieldManager: FIELD_MANAGER_STRING,
 		})
+		return err
+	}
+	if !k8sErrors.IsNotFound(foundErr) {
+		return foundErr
+	}
+	_, err := serviceClient.Create(ctx, &svc, metav1.CreateOptions{
+		FieldManager: FIELD_MANAGER_STRING,
+	})
+	return err
+}
+
+// createNodeServices creates one service per pod of the stateful set and removes
+// services of pods that no longer exist after a scale down
+func createNodeServices(ctx context.Context, clientset *kubernetes.Clientset, options stateFullSetOptions) error {
+	wanted := make(map[string]bool, options.Replicas)
+	for i := int32(0); i < options.Replicas; i++ {
+		svc := buildNodeService(options, i)
+		err := createOrUpdateService(ctx, clientset, svc)
 		if err != nil {
 			return err
 		}
-	} else { //TODO CHECK FOR ACTUAL NOT FOUND ERROR
-		_, err := serviceClient.Create(ctx, &svc, metav1.CreateOptions{
-			FieldManager: FIELD_MANAGER_STRING,
-		})
-		if err != nil {
+		wanted[svc.Name] = true
+	}
+
+	sel := options.Selector()
+	sel = metav1.AddLabelToSelector(sel, NODE_ROUTE_LABEL, "true")
+	selector, err := metav1.LabelSelectorAsSelector(sel)
+	if err != nil {
+		return err
+	}
+
+	serviceClient := clientset.CoreV1().Services(options.Namespace)
+	existing, err := serviceClient.List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return err
+	}
+	for _, svc := range existing.Items {
+		if wanted[svc.Name] {
+			continue
+		}
+		err := serviceClient.Delete(ctx, svc.Name, *metav1.NewDeleteOptions(0))
+		if err != nil && !k8sErrors.IsNotFound(err) {
 			return err
 		}
 	}
+	return nil
+}
 
-	sts := baseStateFullSet(options)
+func createStatefulSetWithOptions(ctx context.Context, restClient *rest.Config, clientset *kubernetes.Clientset, options stateFullSetOptions) error {
+	pending, err := applyRole(ctx, restClient, clientset, options)
+	if err != nil {
+		return err
+	}
 
-	stsClient := clientset.AppsV1().StatefulSets(options.Namespace)
-	var createdSts *appsv1.StatefulSet
-	_, foundErr = stsClient.Get(ctx, options.Name(), metav1.GetOptions{})
-	var err error
-	if foundErr == nil {
-		createdSts, err = stsClient.Update(ctx, &sts, metav1.UpdateOptions{
-			FieldManager: FIELD_MANAGER_STRING,
-		})
+	if pending {
+		err = waitForRole(ctx, clientset, options)
 		if err != nil {
 			return err
 		}
-	} else { //TODO CHECK FOR ACTUAL NOT FOUND ERROR
-		createdSts, err = stsClient.Create(ctx, &sts, metav1.CreateOptions{
-			FieldManager: FIELD_MANAGER_STRING,
-		})
+		_, err = applyRole(ctx, restClient, clientset, options)
 		if err != nil {
 			return err
 		}
 	}
 
-	if createdSts.Status.UpdatedReplicas != options.Replicas || createdSts.Status.AvailableReplicas != options.Replicas {
-		watch, err := stsClient.Watch(ctx, metav1.SingleObject(createdSts.ObjectMeta))
+	return waitForRole(ctx, clientset, options)
+}
+
+// applyRole creates or updates the stateful sets of the role and the services of its pods without
+// waiting for the pods. It reports pending if a changed lower image is rolled out to all pods first,
+// the role has to be applied again once that rollout finished
+func applyRole(ctx context.Context, restClient *rest.Config, clientset *kubernetes.Clientset, options stateFullSetOptions) (bool, error) {
+	svc := buildService(options)
+
+	err := createOrUpdateService(ctx, clientset, svc)
+	if err != nil {
+		return false, err
+	}
+
+	if options.NodeRoutes {
+		err = createNodeServices(ctx, clientset, options)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if options.IsValidator && options.ExposesP2P() {
+		err = exposeStakingPorts(ctx, clientset, options)
 		if err != nil {
-			return err
+			return false, err
 		}
-		for event := range watch.ResultChan() {
-			sts, ok := event.Object.(*appsv1.StatefulSet)
-			if !ok {
-				fmt.Println("could not parse", event)
-				continue
-			}
+	}
 
-			if sts.Status.AvailableReplicas == options.Replicas && sts.Status.UpdatedReplicas == options.Replicas {
-				watch.Stop()
-			}
+	if options.PerNode() {
+		err = checkNoRoleStatefulSet(ctx, clientset, options)
+		if err != nil {
+			return false, err
+		}
+	}
 
-			fmt.Printf("waiting for %s to reach desired state [%d/%d]\n", options.Type, sts.Status.AvailableReplicas, options.Replicas)
+	pending := false
+	for _, set := range options.statefulSets() {
+		setPending, err := applyStatefulSet(ctx, clientset, set)
+		if err != nil {
+			return false, err
 		}
+		pending = pending || setPending
+	}
 
+	if options.PerNode() {
+		err = deleteSurplusNodeSets(ctx, clientset, options)
+		if err != nil {
+			return false, err
+		}
 	}
 
-	if options.EnableMonitoring {
+	if options.EnableMonitoring && !options.ScrapeAnnotations {
 		err := createServiceMonitor(ctx, restClient, options)
 		if err != nil {
-			return err
+			return false, err
 		}
 	}
 
+	return pending, nil
+}
+
+// checkNoRoleStatefulSet fails if the nodes of a role that runs per node still run in one stateful
+// set of the whole role, as networks created before did. Their data volumes are named after the pods
+// and are not picked up by the stateful sets per node
+func checkNoRoleStatefulSet(ctx context.Context, clientset *kubernetes.Clientset, options stateFullSetOptions) error {
+	_, err := clientset.AppsV1().StatefulSets(options.Namespace).Get(ctx, options.Name(), metav1.GetOptions{})
+	if k8sErrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("the %s nodes run in the stateful set %s, which is replaced by one stateful set per node. Destroy and create the network again", options.Type, options.Name())
+}
+
+// deleteSurplusNodeSets removes the stateful sets of nodes that no longer exist after a scale down,
+// their data volumes are kept like the ones of a scaled down stateful set
+func deleteSurplusNodeSets(ctx context.Context, clientset *kubernetes.Clientset, options stateFullSetOptions) error {
+	selector, err := metav1.LabelSelectorAsSelector(options.Selector())
+	if err != nil {
+		return err
+	}
+
+	stsClient := clientset.AppsV1().StatefulSets(options.Namespace)
+	existing, err := stsClient.List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return err
+	}
+	for _, sts := range existing.Items {
+		ordinal, err := strconv.Atoi(sts.Labels[NODE_ORDINAL_LABEL])
+		if err != nil || int32(ordinal) < options.Replicas {
+			continue
+		}
+		err = stsClient.Delete(ctx, sts.Name, *metav1.NewDeleteOptions(0))
+		if err != nil && !k8sErrors.IsNotFound(err) {
+			return err
+		}
+	}
 	return nil
 }
 
+// applyStatefulSet creates or updates a single stateful set of the role. It reports pending if a changed
+// lower image is rolled out to all pods first, the set has to be applied again once that rollout finished
+func applyStatefulSet(ctx context.Context, clientset *kubernetes.Clientset, options stateFullSetOptions) (bool, error) {
+	lowerImage, upperImage, partition, err := imageRevisions(options)
+	if err != nil {
+		return false, err
+	}
+	split := partition < options.Replicas
+
+	sts := baseStateFullSet(options)
+	if split {
+		// the pods of the upper image must not roll back while the lower image is applied
+		sts.Spec.UpdateStrategy = partitionedUpdate(options.Replicas)
+		setTemplateHash(&sts)
+	}
+
+	stsClient := clientset.AppsV1().StatefulSets(options.Namespace)
+	found, foundErr := stsClient.Get(ctx, options.Name(), metav1.GetOptions{})
+	if foundErr == nil {
+		// a changed lower template has to be rolled out to all pods before the set is split again,
+		// which is only done while no pod runs another image than the lower one
+		rolledOut := true
+		if split {
+			rolledOut, err = lowerTemplateRolledOut(ctx, clientset, options, sts, partition)
+			if err != nil {
+				return false, err
+			}
+			if !rolledOut {
+				err = checkNoRollback(ctx, clientset, options, lowerImage, upperImage, partition)
+				if err != nil {
+					return false, err
+				}
+				sts.Spec.UpdateStrategy = partitionedUpdate(0)
+			}
+		}
+
+		// volume claim templates are immutable, existing claims are resized instead
+		if (len(found.Spec.VolumeClaimTemplates) == 0) != options.K8sConfig.Storage.Ephemeral {
+			return false, fmt.Errorf("cannot switch %s between ephemeral and persistent storage, destroy the network first", options.Name())
+		}
+		sts.Spec.VolumeClaimTemplates = found.Spec.VolumeClaimTemplates
+
+		err = expandDataVolumes(ctx, clientset, options)
+		if err != nil {
+			return false, err
+		}
+
+		_, err = stsClient.Update(ctx, &sts, metav1.UpdateOptions{
+			FieldManager: FIELD_MANAGER_STRING,
+		})
+		if err != nil {
+			return false, err
+		}
+
+		if !rolledOut {
+			return true, nil
+		}
+	} else { //TODO CHECK FOR ACTUAL NOT FOUND ERROR
+		created := sts
+		if split {
+			// the pods from partition on must never start with the lower image, they are only
+			// added by rolloutUpperImage once the template runs the upper image
+			created.Spec.Replicas = &partition
+		}
+		_, err = stsClient.Create(ctx, &created, metav1.CreateOptions{
+			FieldManager: FIELD_MANAGER_STRING,
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if split {
+		err = rolloutUpperImage(ctx, clientset, options, sts, upperImage, partition)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return false, nil
+}
+
 func baseStateFullSet(options stateFullSetOptions) appsv1.StatefulSet {
 
-	labels := options.Labels()
+	labels := options.podLabels()
 
-	initContainers := make([]corev1.Container, 0)
+	volumes := append(defaultVolumes(options.K8sConfig), nodeConfigVolume(options))
 
 	if options.IsValidator {
-		initContainers = append(initContainers, validatorInitContainer(options))
+		volumes = append(volumes, certVolume(options))
+	}
+	var volumeClaimTemplates []corev1.PersistentVolumeClaim
+
+	if options.K8sConfig.Storage.Ephemeral {
+		volumes = append(volumes, corev1.Volume{
+			Name: DATA_VOLUME_NAME, VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			}})
+	} else {
+		volumeClaimTemplates = []corev1.PersistentVolumeClaim{
+			buildDataVolumeClaim(options),
+		}
+	}
+
+	podSpec := corev1.PodSpec{
+		ImagePullSecrets: []corev1.LocalObjectReference{
+			{
+				Name: options.PullSecretName,
+			},
+		},
+		Containers: []corev1.Container{
+			buildContainer(options),
+		},
+		Volumes: volumes,
+	}
+	applyScheduling(&podSpec, options)
+
+	podAnnotations := map[string]string{
+		NODE_CONFIG_HASH_ANNOTATION: nodeConfigHash(options),
+	}
+	if options.EnableMonitoring && options.ScrapeAnnotations {
+		podAnnotations["prometheus.io/scrape"] = "true"
+		podAnnotations["prometheus.io/port"] = "9650"
+		podAnnotations["prometheus.io/path"] = "/ext/metrics"
 	}
 
 	return appsv1.StatefulSet{
@@ -146,39 +394,12 @@ func baseStateFullSet(options stateFullSetOptions) appsv1.StatefulSet {
 			},
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
-					Labels: labels,
-				},
-				Spec: corev1.PodSpec{
-					ImagePullSecrets: []corev1.LocalObjectReference{
-						{
-							Name: options.PullSecretName,
-						},
-					},
-					ServiceAccountName: options.PrefixWith("init-container"),
-					InitContainers:     initContainers,
-					Containers: []corev1.Container{
-						buildContainer(options),
-					},
-					Volumes: defaultVolumes(options.K8sConfig),
-				},
-			},
-			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Name: "data-vol",
-					},
-					Spec: corev1.PersistentVolumeClaimSpec{
-						AccessModes: []corev1.PersistentVolumeAccessMode{
-							corev1.ReadWriteOnce,
-						},
-						Resources: corev1.ResourceRequirements{
-							Requests: corev1.ResourceList{
-								corev1.ResourceStorage: resource.MustParse("10Gi"),
-							},
-						},
-					},
+					Labels:      labels,
+					Annotations: podAnnotations,
 				},
+				Spec: podSpec,
 			},
+			VolumeClaimTemplates: volumeClaimTemplates,
 		},
 	}
 
@@ -193,29 +414,34 @@ func buildContainer(options stateFullSetOptions) corev1.Container {
 		},
 	}
 
-	volumeMounts := defaultVolumeMounts()
+	volumeMounts := append(defaultVolumeMounts(), corev1.VolumeMount{
+		Name:      NODE_CONFIG_VOLUME_NAME,
+		MountPath: NODE_CONFIG_MOUNT_PATH,
+		ReadOnly:  true,
+	})
 
+	if options.hasStakingContainerPort() {
+		ports = append(ports, corev1.ContainerPort{Name: "staking", ContainerPort: options.StakingPort(0)})
+	}
 	if options.IsValidator {
-		ports = append(ports, corev1.ContainerPort{Name: "staking", ContainerPort: 9651})
 		volumeMounts = append(volumeMounts, corev1.VolumeMount{
 			Name:      "cert-vol",
 			MountPath: "/mnt/cert",
+			ReadOnly:  true,
+		}, corev1.VolumeMount{
+			Name:      "p2p-vol",
+			MountPath: "/mnt/p2p",
+			ReadOnly:  true,
 		})
 	}
 
 	container := corev1.Container{
-		Name:  "camino-node",
-		Image: options.Image,
+		Name:  NODE_CONTAINER_NAME,
+		Image: options.Image(0),
 		Resources: corev1.ResourceRequirements{
 			Requests: options.Requests,
+			Limits:   options.Limits,
 		},
-		// LivenessProbe: &corev1.Probe{
-		// 	ProbeHandler: corev1.ProbeHandler{
-		// 		Exec: &corev1.ExecAction{
-		// 			Command: ,
-		// 		},
-		// 	},
-		// },
 		Env: []corev1.EnvVar{
 			{
 				Name: "ROOT_NODE_ID",
@@ -232,6 +458,11 @@ func buildContainer(options stateFullSetOptions) corev1.Container {
 				Name:  "NETWORK_NAME",
 				Value: options.K8sPrefix,
 			},
+			{
+				// the name of the network id is also the directory of the database
+				Name:  "NETWORK_ID",
+				Value: version1.NetworkIDName(options.NetworkID),
+			},
 			{
 				Name:  "IS_API_NODE",
 				Value: strconv.FormatBool(!(options.IsValidator || options.IsRoot)),
@@ -244,6 +475,14 @@ func buildContainer(options stateFullSetOptions) corev1.Container {
 					},
 				},
 			},
+			{
+				Name: "HOST_IP",
+				ValueFrom: &corev1.EnvVarSource{
+					FieldRef: &corev1.ObjectFieldSelector{
+						FieldPath: "status.hostIP",
+					},
+				},
+			},
 			{
 				Name:  "IS_ROOT",
 				Value: strconv.FormatBool(options.IsValidator && options.IsRoot),
@@ -256,12 +495,17 @@ func buildContainer(options stateFullSetOptions) corev1.Container {
 		VolumeMounts: volumeMounts,
 	}
 
+	if !options.Probes.Disabled {
+		addProbes(&container, options.Probe)
+	}
+
 	return container
 }
 
 func defaultVolumes(k8sConfig version1.K8sConfig) []corev1.Volume {
 
 	defaultMode := int32(0555)
+	optional := true
 
 	return []corev1.Volume{
 		{Name: "conf-vol", VolumeSource: corev1.VolumeSource{
@@ -280,10 +524,14 @@ func defaultVolumes(k8sConfig version1.K8sConfig) []corev1.Volume {
 				DefaultMode: &defaultMode,
 			},
 		}},
-		{
-			Name: "cert-vol", VolumeSource: corev1.VolumeSource{
-				EmptyDir: &corev1.EmptyDirVolumeSource{},
-			}},
+		{Name: "p2p-vol", VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: p2pConfigMapName(k8sConfig),
+				},
+				Optional: &optional,
+			},
+		}},
 	}
 }
 
@@ -295,7 +543,7 @@ func defaultVolumeMounts() []corev1.VolumeMount {
 			ReadOnly:  true,
 		},
 		{
-			Name:      "data-vol",
+			Name:      DATA_VOLUME_NAME,
 			MountPath: "/mnt/data",
 		},
 		{
@@ -305,43 +553,34 @@ func defaultVolumeMounts() []corev1.VolumeMount {
 	}
 }
 
-func validatorInitContainer(options stateFullSetOptions) corev1.Container {
-
-	envs := []corev1.EnvVar{
-		{
-			Name: "NAMESPACE",
-			ValueFrom: &corev1.EnvVarSource{
-				FieldRef: &corev1.ObjectFieldSelector{
-					FieldPath: "metadata.namespace",
+// certVolume holds the certificate and key of the staker of the pod. A pod only mounts the secret
+// of its own staker, which is why the validators run a stateful set per node, see PerNode
+func certVolume(options stateFullSetOptions) corev1.Volume {
+	keyMode := int32(0400)
+
+	return corev1.Volume{
+		Name: "cert-vol",
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: fmt.Sprintf("%s-%d", options.K8sPrefix, options.StakerIndex(0)),
+				// the node does not need the private key of the staker
+				Items: []corev1.KeyToPath{
+					{Key: corev1.TLSCertKey, Path: corev1.TLSCertKey},
+					{Key: corev1.TLSPrivateKeyKey, Path: corev1.TLSPrivateKeyKey, Mode: &keyMode},
 				},
 			},
 		},
-		{
-			Name:  "SECRET_PREFIX",
-			Value: options.K8sPrefix,
-		},
-	}
-
-	if options.IsRoot {
-		envs = append(envs, corev1.EnvVar{
-			Name:  "IS_ROOT",
-			Value: "true",
-		})
 	}
+}
 
-	return corev1.Container{
-		Name:  "init-certificates",
-		Image: "bitnami/kubectl:latest",
-		Env:   envs,
-		Command: []string{
-			"bash", "/mnt/scripts/init.sh",
-		},
-		VolumeMounts: append(defaultVolumeMounts(), corev1.VolumeMount{
-			Name:      "cert-vol",
-			MountPath: "/mnt/cert",
-			ReadOnly:  false,
-		}),
-	}
+// nodeServiceExcludingSelector makes sure per node services are not selected
+// in addition to the service of the whole stateful set
+func nodeServiceExcludingSelector(sel *metav1.LabelSelector) *metav1.LabelSelector {
+	sel.MatchExpressions = append(sel.MatchExpressions, metav1.LabelSelectorRequirement{
+		Key:      NODE_ROUTE_LABEL,
+		Operator: metav1.LabelSelectorOpDoesNotExist,
+	})
+	return sel
 }
 
 func createServiceMonitor(ctx context.Context, restClient *rest.Config, options stateFullSetOptions) error {
@@ -357,7 +596,7 @@ func createServiceMonitor(ctx context.Context, restClient *rest.Config, options
 		},
 		Spec: promv1.ServiceMonitorSpec{
 			JobLabel: options.Name(),
-			Selector: *options.Selector(),
+			Selector: *nodeServiceExcludingSelector(options.Selector()),
 			Endpoints: []promv1.Endpoint{
 				{
 					Path:     "/ext/metrics",
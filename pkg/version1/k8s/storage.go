@@ -0,0 +1,100 @@
+/*
+ * storage.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const DATA_VOLUME_NAME = "data-vol"
+
+func buildDataVolumeClaim(options stateFullSetOptions) corev1.PersistentVolumeClaim {
+	storage := options.DataVolume
+
+	accessMode := storage.AccessMode
+	if accessMode == "" {
+		accessMode = corev1.ReadWriteOnce
+	}
+
+	claim := corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   DATA_VOLUME_NAME,
+			Labels: options.Labels(),
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{
+				accessMode,
+			},
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: storage.Size,
+				},
+			},
+		},
+	}
+
+	// an empty class would disable dynamic provisioning, nil selects the default class
+	if storage.StorageClass != "" {
+		claim.Spec.StorageClassName = &storage.StorageClass
+	}
+
+	return claim
+}
+
+// dataVolumeClaimName is the name the stateful set controller gives the claim of the pod with the given ordinal
+func dataVolumeClaimName(options stateFullSetOptions, ordinal int32) string {
+	return fmt.Sprintf("%s-%s", DATA_VOLUME_NAME, options.PodName(ordinal))
+}
+
+// expandDataVolumes raises the requested size of existing claims of the stateful set.
+// The storage class has to allow volume expansion, claims are never shrunk
+func expandDataVolumes(ctx context.Context, clientset *kubernetes.Clientset, options stateFullSetOptions) error {
+	pvcClient := clientset.CoreV1().PersistentVolumeClaims(options.Namespace)
+	desired := options.DataVolume.Size
+
+	for i := int32(0); i < options.Replicas; i++ {
+		name := dataVolumeClaimName(options, i)
+		pvc, err := pvcClient.Get(ctx, name, metav1.GetOptions{})
+		if k8sErrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		current := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+		switch desired.Cmp(current) {
+		case 0:
+			continue
+		case -1:
+			log.Printf("not shrinking %s from %s to %s\n", name, current.String(), desired.String())
+			continue
+		}
+
+		if options.DataVolume.StorageClass != "" && pvc.Spec.StorageClassName != nil && *pvc.Spec.StorageClassName != options.DataVolume.StorageClass {
+			log.Printf("storage class of existing claim %s cannot be changed, keeping %s\n", name, *pvc.Spec.StorageClassName)
+		}
+
+		log.Printf("expanding %s from %s to %s\n", name, current.String(), desired.String())
+		pvc.Spec.Resources.Requests[corev1.ResourceStorage] = desired
+		_, err = pvcClient.Update(ctx, pvc, metav1.UpdateOptions{
+			FieldManager: FIELD_MANAGER_STRING,
+		})
+		if err != nil {
+			return fmt.Errorf("could not expand %s, does the storage class allow volume expansion? %w", name, err)
+		}
+	}
+
+	return nil
+}
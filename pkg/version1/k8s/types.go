@@ -7,13 +7,21 @@
 package k8s
 
 import (
+	"fmt"
+
 	"chain4travel.com/camktncr/pkg/version1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 const (
-	NODE_ID_KEY = "Node-ID"
+	NODE_ID_KEY      = "Node-ID"
+	NODE_ROUTE_LABEL = "node-route"
+	P2P_LABEL        = "p2p"
+	STAKING_PORT     = 9651
+
+	// NODE_ORDINAL_LABEL is the ordinal of the node within its role on roles that run a stateful set per node
+	NODE_ORDINAL_LABEL = "node-ordinal"
 )
 
 type stateFullSetOptions struct {
@@ -23,18 +31,113 @@ type stateFullSetOptions struct {
 	IsRoot      bool
 	Replicas    int32
 	Requests    corev1.ResourceList
+	Limits      corev1.ResourceList
+	Scheduling  version1.K8sScheduling
+	DataVolume  version1.K8sStorage
+	Probe       version1.K8sProbe
+	// IsNodeSet marks the stateful set of a single node of a role that runs per node, see PerNode
+	IsNodeSet   bool
+	NodeOrdinal int32
+}
+
+// PerNode reports if every node of the role runs in a stateful set of its own. Validators do, a pod
+// template cannot name the secret of the staker of an ordinal and a pod must not see other stakers
+func (s stateFullSetOptions) PerNode() bool {
+	return s.Type == "validator" && !s.IsNodeSet
+}
+
+// nodeSet configures the stateful set of the node with the given ordinal of a role that runs per node
+func (s stateFullSetOptions) nodeSet(ordinal int32) stateFullSetOptions {
+	set := s
+	set.IsNodeSet = true
+	set.NodeOrdinal = ordinal
+	set.Replicas = 1
+	return set
+}
+
+// statefulSets are the stateful sets the nodes of the role run in
+func (s stateFullSetOptions) statefulSets() []stateFullSetOptions {
+	if !s.PerNode() {
+		return []stateFullSetOptions{s}
+	}
+	sets := make([]stateFullSetOptions, 0, s.Replicas)
+	for i := int32(0); i < s.Replicas; i++ {
+		sets = append(sets, s.nodeSet(i))
+	}
+	return sets
 }
 
 func (s stateFullSetOptions) Name() string {
+	if s.IsNodeSet {
+		return s.PrefixWith(fmt.Sprintf("%s-%d", s.Type, s.NodeOrdinal))
+	}
 	return s.PrefixWith(s.Type)
 }
 
+func (s stateFullSetOptions) PodName(ordinal int32) string {
+	if s.PerNode() {
+		return s.nodeSet(ordinal).PodName(0)
+	}
+	return fmt.Sprintf("%s-%d", s.Name(), ordinal)
+}
+
+// Ordinal maps the ordinal of a pod in the stateful set to the ordinal of the node within its role
+func (s stateFullSetOptions) Ordinal(ordinal int32) int32 {
+	return s.NodeOrdinal + ordinal
+}
+
+// Image is the camino-node image of the pod with the given ordinal
+func (s stateFullSetOptions) Image(ordinal int32) string {
+	return s.NodeImage(s.Type, s.Ordinal(ordinal))
+}
+
+// StakerIndex maps the ordinal of a pod to the index of the staker it runs with,
+// the root node uses the first staker and the validators the following ones
+func (s stateFullSetOptions) StakerIndex(ordinal int32) int32 {
+	if s.IsRoot {
+		return ordinal
+	}
+	return s.Ordinal(ordinal) + 1
+}
+
+// StakingPort is the port the pod with the given ordinal listens on for p2p traffic.
+// Node ports cannot be remapped so in that mode every validator listens on its own node port
+func (s stateFullSetOptions) StakingPort(ordinal int32) int32 {
+	if s.P2PExposure == version1.P2P_EXPOSURE_NODEPORT {
+		return s.P2PNodePortBase + s.StakerIndex(ordinal)
+	}
+	return STAKING_PORT
+}
+
+// hasStakingContainerPort reports if all pods of the stateful set listen on the same staking port.
+// In nodeport mode every validator listens on its own node port, which a pod template cannot
+// name, so only the root node that is bootstrapped from through its service has one
+func (s stateFullSetOptions) hasStakingContainerPort() bool {
+	if !s.IsValidator {
+		return false
+	}
+	return s.IsRoot || s.P2PExposure != version1.P2P_EXPOSURE_NODEPORT
+}
+
 func (s stateFullSetOptions) Labels() map[string]string {
-	labels := s.K8sConfig.Labels
+	labels := make(map[string]string, len(s.K8sConfig.Labels)+1)
+	for k, v := range s.K8sConfig.Labels {
+		labels[k] = v
+	}
 	labels["type"] = s.Type
 	return labels
 }
 
+// podLabels select the pods of the stateful set, the stateful sets of a role that runs per node
+// must not select the pods of each other
+func (s stateFullSetOptions) podLabels() map[string]string {
+	labels := s.Labels()
+	if s.IsNodeSet {
+		labels[NODE_ORDINAL_LABEL] = fmt.Sprintf("%d", s.NodeOrdinal)
+	}
+	return labels
+}
+
 func (s stateFullSetOptions) Selector() *metav1.LabelSelector {
 	sel := &metav1.LabelSelector{}
 
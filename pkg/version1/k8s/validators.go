@@ -1,7 +1,6 @@
 package k8s
 
 import (
-	"bytes"
 	"context"
 	"crypto/sha1"
 	"encoding/hex"
@@ -11,76 +10,57 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
-	"net/url"
 	"strings"
 	"time"
 
 	"chain4travel.com/camktncr/pkg/version1"
 	"golang.org/x/sync/errgroup"
 	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/portforward"
-	"k8s.io/client-go/transport/spdy"
 )
 
 const DEFAULT_PENDING_TIME_OFFSET = 2 * time.Minute
 const SYNC_BOUND = time.Minute
 
-func RegisterValidators(ctx context.Context, restClient *rest.Config, k8sConfig version1.K8sConfig, stakers []version1.Staker, allowError bool) error {
-	roundTripper, upgrader, err := spdy.RoundTripperFor(restClient)
-	if err != nil {
-		return err
-	}
-
-	path := fmt.Sprintf("/api/v1/namespaces/%s/pods/%s/portforward", k8sConfig.Namespace, fmt.Sprintf("%s-root-0", k8sConfig.K8sPrefix))
-	hostIP := strings.TrimLeft(restClient.Host, "htps:/")
-	serverURL := url.URL{Scheme: "https", Path: path, Host: hostIP}
-
-	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: roundTripper}, http.MethodPost, &serverURL)
-
-	stopChan, readyChan := make(chan struct{}, 1), make(chan struct{}, 1)
-	out, errOut := new(bytes.Buffer), new(bytes.Buffer)
+// RegisteredValidator is a staker that was added as validator, TxID is empty if it already was one
+type RegisteredValidator struct {
+	NodeID string `json:"nodeId"`
+	TxID   string `json:"txId,omitempty"`
+}
 
-	forwarder, err := portforward.New(dialer, []string{"9650"}, stopChan, readyChan, out, errOut)
+func RegisterValidators(ctx context.Context, restClient *rest.Config, k8sConfig version1.K8sConfig, stakers []version1.Staker, allowError bool) ([]RegisteredValidator, error) {
+	rootPod := stateFullSetOptions{K8sConfig: k8sConfig, Type: "root", IsRoot: true}.PodName(0)
+	forward, err := ForwardPort(ctx, restClient, k8sConfig.Namespace, rootPod, HTTP_PORT)
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	go func() {
-		for range readyChan { // Kubernetes will close this channel when it has something to tell us.
-		}
-		if len(errOut.String()) != 0 {
-			panic(errOut.String())
-		} else if len(out.String()) != 0 {
-			fmt.Println(out.String())
-		}
-	}()
-
-	go func() {
-		if err = forwarder.ForwardPorts(); err != nil { // Locks until stopChan is closed.
-			fmt.Println(err)
-		}
-	}()
-	time.Sleep(1 * time.Second) // waiting for the connection to open kinda hacky ngl
-	defer close(stopChan)
+	defer forward.Close()
+	endpoint := forward.Endpoint()
 
 	for {
-		err := isBootstrapped()
+		err := isBootstrapped(endpoint)
 		if err != nil {
 			log.Println("root has not bootstrapped yet")
 		} else {
 			break
 		}
-		time.Sleep(DEFAULT_TIMEOUT)
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("root did not bootstrap: %w", ctx.Err())
+		case <-time.After(DEFAULT_TIMEOUT):
+		}
 	}
 
 	g, ctx := errgroup.WithContext(ctx)
 
-	for _, staker := range stakers {
+	registered := make([]RegisteredValidator, len(stakers))
+	for i, staker := range stakers {
+		i, staker := i, staker
 		g.Go(func() error {
-			err := registerValidator(ctx, staker, allowError)
+			txId, err := registerValidator(ctx, endpoint, staker, allowError)
 			if err != nil {
 				return err
 			}
+			registered[i] = RegisteredValidator{NodeID: staker.NodeID.String(), TxID: txId}
 			return nil
 		})
 		time.Sleep(1 * time.Second)
@@ -88,10 +68,10 @@ func RegisterValidators(ctx context.Context, restClient *rest.Config, k8sConfig
 
 	err = g.Wait()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return registered, nil
 }
 
 type ResultResp struct {
@@ -106,7 +86,7 @@ type ResultResp struct {
 
 var errNotAddedToMempool = errors.New("tx was not added to mempool")
 
-func verifyStatus(ctx context.Context, staker version1.Staker, txId string) error {
+func verifyStatus(ctx context.Context, endpoint string, staker version1.Staker, txId string) error {
 
 	for {
 		select {
@@ -123,7 +103,7 @@ func verifyStatus(ctx context.Context, staker version1.Staker, txId string) erro
 				}
 			}`, txId))
 
-			res, err := http.Post("http://localhost:9650/ext/bc/P", "application/json", getTxStatusPayload)
+			res, err := http.Post(endpoint+"/ext/bc/P", "application/json", getTxStatusPayload)
 			if err != nil {
 				return err
 			}
@@ -133,15 +113,13 @@ func verifyStatus(ctx context.Context, staker version1.Staker, txId string) erro
 				return err
 			}
 
-			fmt.Println(string(body))
-
 			var txStatus ResultResp
 			err = json.Unmarshal(body, &txStatus)
 			if err != nil {
 				return err
 			}
 
-			fmt.Printf("%s: TXID %s Status: %s\n", staker.NodeID, txId, txStatus.Result.Status)
+			log.Printf("%s: TXID %s Status: %s\n", staker.NodeID, txId, txStatus.Result.Status)
 
 			switch txStatus.Result.Status {
 			case "Committed":
@@ -155,14 +133,14 @@ func verifyStatus(ctx context.Context, staker version1.Staker, txId string) erro
 	}
 }
 
-func waitForValidatorToBecomeActive(ctx context.Context, staker version1.Staker) error {
+func waitForValidatorToBecomeActive(ctx context.Context, endpoint string, staker version1.Staker) error {
 	for {
 
 		select {
 		case <-ctx.Done():
 			return fmt.Errorf("could not wait for validator %s to become active. Reason: %v", staker.NodeID, ctx.Err())
 		default:
-			active, err := isActiveValidator(staker)
+			active, err := isActiveValidator(endpoint, staker)
 			if err != nil {
 				return err
 			}
@@ -171,7 +149,7 @@ func waitForValidatorToBecomeActive(ctx context.Context, staker version1.Staker)
 				return nil
 			}
 
-			fmt.Printf("validator %s not active yet\n", staker.NodeID)
+			log.Printf("validator %s not active yet\n", staker.NodeID)
 			time.Sleep(DEFAULT_PENDING_TIME_OFFSET / 10)
 
 		}
@@ -179,7 +157,7 @@ func waitForValidatorToBecomeActive(ctx context.Context, staker version1.Staker)
 	}
 }
 
-func isActiveValidator(staker version1.Staker) (bool, error) {
+func isActiveValidator(endpoint string, staker version1.Staker) (bool, error) {
 	getCurrentValidatorsPayload := strings.NewReader(`{
 			"jsonrpc": "2.0",
 			"method": "platform.getCurrentValidators",
@@ -190,7 +168,7 @@ func isActiveValidator(staker version1.Staker) (bool, error) {
 			"id": 1
 		}`)
 
-	res, err := http.Post("http://localhost:9650/ext/bc/P", "application/json", getCurrentValidatorsPayload)
+	res, err := http.Post(endpoint+"/ext/bc/P", "application/json", getCurrentValidatorsPayload)
 	if err != nil {
 		return false, err
 	}
@@ -208,7 +186,7 @@ func isActiveValidator(staker version1.Staker) (bool, error) {
 
 }
 
-func isPendingValidator(staker version1.Staker) (bool, error) {
+func isPendingValidator(endpoint string, staker version1.Staker) (bool, error) {
 	getPendingValidatorsPayload := strings.NewReader(`{
 			"jsonrpc": "2.0",
 			"method": "platform.getPendingValidators",
@@ -219,7 +197,7 @@ func isPendingValidator(staker version1.Staker) (bool, error) {
 			"id": 1
 		}`)
 
-	res, err := http.Post("http://localhost:9650/ext/bc/P", "application/json", getPendingValidatorsPayload)
+	res, err := http.Post(endpoint+"/ext/bc/P", "application/json", getPendingValidatorsPayload)
 	if err != nil {
 		return false, err
 	}
@@ -237,10 +215,10 @@ func isPendingValidator(staker version1.Staker) (bool, error) {
 
 }
 
-func registerValidator(ctx context.Context, staker version1.Staker, allowError bool) error {
+func registerValidator(ctx context.Context, endpoint string, staker version1.Staker, allowError bool) (string, error) {
 	day, err := time.ParseDuration("24h")
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	stakeDur := day * 30
@@ -258,18 +236,16 @@ func registerValidator(ctx context.Context, staker version1.Staker, allowError b
 				"password": "%s"
 			}
 		}`, username, password))
-	res, err := http.Post("http://localhost:9650/ext/keystore", "application/json", createUserPostData)
+	res, err := http.Post(endpoint+"/ext/keystore", "application/json", createUserPostData)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	body, err := ioutil.ReadAll(res.Body)
+	_, err = ioutil.ReadAll(res.Body)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	fmt.Println(string(body))
-
 	importKeyPostData := strings.NewReader(fmt.Sprintf(`{
 			"jsonrpc":"2.0",
 			"id"     :1,
@@ -280,50 +256,49 @@ func registerValidator(ctx context.Context, staker version1.Staker, allowError b
 				"privateKey":"%s"
 			}
 		}`, username, password, staker.PrivateKey))
-	res, err = http.Post("http://localhost:9650/ext/bc/P", "application/json", importKeyPostData)
+	res, err = http.Post(endpoint+"/ext/bc/P", "application/json", importKeyPostData)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	body, err = ioutil.ReadAll(res.Body)
+	_, err = ioutil.ReadAll(res.Body)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	fmt.Println(string(body))
-
+	// stays empty if the validator was registered before
+	var txId string
 	count := 0
 	startTime := time.Now().Add(DEFAULT_PENDING_TIME_OFFSET + SYNC_BOUND)
 	endTime := startTime.Add(stakeDur)
 
 	for {
 		count++
-		fmt.Printf("Attempt %d: %s\n", count, staker.NodeID)
+		log.Printf("Attempt %d: %s\n", count, staker.NodeID)
 
-		active, err := isActiveValidator(staker)
+		active, err := isActiveValidator(endpoint, staker)
 		if err != nil {
-			return err
+			return "", err
 		}
 
 		if active {
-			return nil
+			return txId, nil
 		}
 
-		pending, err := isPendingValidator(staker)
+		pending, err := isPendingValidator(endpoint, staker)
 		if err != nil {
-			return err
+			return "", err
 		}
 
 		if pending {
-			return waitForValidatorToBecomeActive(ctx, staker)
+			return txId, waitForValidatorToBecomeActive(ctx, endpoint, staker)
 		}
 
 		select {
 		case <-ctx.Done():
-			return fmt.Errorf("could not add %s as a validator: %v", staker.NodeID, ctx.Err())
+			return "", fmt.Errorf("could not add %s as a validator: %v", staker.NodeID, ctx.Err())
 		default:
 			if time.Now().After(startTime) {
-				fmt.Println("XXXXXX")
 				startTime = time.Now().Add(DEFAULT_PENDING_TIME_OFFSET + SYNC_BOUND)
 			}
 			addVaidatorPostData := strings.NewReader(fmt.Sprintf(`{
@@ -341,61 +316,60 @@ func registerValidator(ctx context.Context, staker version1.Staker, allowError b
 				"password": "%s"
 			}
 		}`, staker.NodeID.String(), startTime.Unix(), endTime.Unix(), staker.Stake, addr, username, password))
-			println(addVaidatorPostData)
-			res, err = http.Post("http://localhost:9650/ext/bc/P", "application/json", addVaidatorPostData)
+			res, err = http.Post(endpoint+"/ext/bc/P", "application/json", addVaidatorPostData)
 			if err != nil {
-				return err
+				return "", err
 			}
 
-			body, err = ioutil.ReadAll(res.Body)
+			body, err := ioutil.ReadAll(res.Body)
 			if err != nil {
-				return err
+				return "", err
 			}
 
 			var result ResultResp
 			err = json.Unmarshal(body, &result)
 			if err != nil {
-				return err
+				return "", err
 			}
 
-			txId := result.Result.TxID
+			txId = result.Result.TxID
 			err = fmt.Errorf("failed to add validator %s - Reason: %s", staker.NodeID, result.Error.Message)
 			if txId == "" {
 				if allowError {
-					fmt.Println("Ignoring error:", err)
+					log.Println("Ignoring error:", err)
 					time.Sleep(DEFAULT_TIMEOUT)
 					continue
 				} else {
-					return err
+					return "", err
 				}
 			}
 
 			time.Sleep(DEFAULT_TIMEOUT)
 
-			err = verifyStatus(ctx, staker, txId)
+			err = verifyStatus(ctx, endpoint, staker, txId)
 			if err != nil {
 				if err == errNotAddedToMempool {
 					continue
 				}
-				return err
+				return "", err
 			}
 
 			time.Sleep(DEFAULT_TIMEOUT)
 
-			err = waitForValidatorToBecomeActive(ctx, staker)
+			err = waitForValidatorToBecomeActive(ctx, endpoint, staker)
 			if err != nil {
-				return err
+				return "", err
 			}
 
-			return nil
+			return txId, nil
 
 		}
 	}
 
 }
 
-func isBootstrapped() error {
-	url := "http://localhost:9650/ext/info"
+func isBootstrapped(endpoint string) error {
+	url := endpoint + "/ext/info"
 	method := "POST"
 
 	payload := strings.NewReader(`{
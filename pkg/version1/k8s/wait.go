@@ -0,0 +1,282 @@
+/*
+ * wait.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// restarts after which a crash looping container is not expected to recover
+	CRASH_LOOP_RESTARTS = 3
+	// time a pod may stay unschedulable, e.g. while the cluster autoscaler adds nodes
+	UNSCHEDULABLE_TIMEOUT = 5 * time.Minute
+	FAILURE_LOG_LINES     = 20
+)
+
+// container waiting reasons that do not resolve without changing the configuration
+var fatalWaitingReasons = map[string]bool{
+	"ImagePullBackOff":           true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+}
+
+// podFailure describes why a pod does not become ready
+type podFailure struct {
+	Pod       string
+	Container string
+	Reason    string
+	Message   string
+	// Fatal failures abort the wait
+	Fatal bool
+	// Previous is set if the logs of the last terminated container explain the failure
+	Previous bool
+}
+
+func (f podFailure) String() string {
+	out := fmt.Sprintf("%s: %s", f.Pod, f.Reason)
+	if f.Message != "" {
+		out = fmt.Sprintf("%s (%s)", out, f.Message)
+	}
+	return out
+}
+
+// checkPod returns the failure of a pod that is not starting, nil if it is starting normally
+func checkPod(pod corev1.Pod, now time.Time) *podFailure {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodScheduled && cond.Status == corev1.ConditionFalse && cond.Reason == corev1.PodReasonUnschedulable {
+			return &podFailure{
+				Pod:     pod.Name,
+				Reason:  cond.Reason,
+				Message: cond.Message,
+				Fatal:   now.Sub(cond.LastTransitionTime.Time) > UNSCHEDULABLE_TIMEOUT,
+			}
+		}
+	}
+
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if status.State.Waiting != nil {
+			waiting := status.State.Waiting
+			switch {
+			case fatalWaitingReasons[waiting.Reason]:
+				return &podFailure{Pod: pod.Name, Container: status.Name, Reason: waiting.Reason, Message: waiting.Message, Fatal: true}
+			case waiting.Reason == "CrashLoopBackOff":
+				message := fmt.Sprintf("restarted %d times", status.RestartCount)
+				if last := status.LastTerminationState.Terminated; last != nil {
+					message = fmt.Sprintf("%s, last exit code %d %s", message, last.ExitCode, last.Reason)
+				}
+				return &podFailure{
+					Pod:       pod.Name,
+					Container: status.Name,
+					Reason:    waiting.Reason,
+					Message:   message,
+					Fatal:     status.RestartCount >= CRASH_LOOP_RESTARTS,
+					Previous:  true,
+				}
+			case waiting.Reason == "ErrImagePull":
+				return &podFailure{Pod: pod.Name, Container: status.Name, Reason: waiting.Reason, Message: waiting.Message}
+			}
+		}
+		if terminated := status.State.Terminated; terminated != nil && terminated.ExitCode != 0 {
+			return &podFailure{
+				Pod:       pod.Name,
+				Container: status.Name,
+				Reason:    terminated.Reason,
+				Message:   fmt.Sprintf("exit code %d", terminated.ExitCode),
+			}
+		}
+	}
+
+	return nil
+}
+
+// containerLogTail returns the last lines of the container that failed
+func containerLogTail(ctx context.Context, clientset *kubernetes.Clientset, namespace string, failure podFailure) string {
+	if failure.Container == "" {
+		return ""
+	}
+	tail := int64(FAILURE_LOG_LINES)
+	logs, err := clientset.CoreV1().Pods(namespace).GetLogs(failure.Pod, &corev1.PodLogOptions{
+		Container: failure.Container,
+		TailLines: &tail,
+		Previous:  failure.Previous,
+	}).DoRaw(ctx)
+	if err != nil {
+		return fmt.Sprintf("could not read logs: %v", err)
+	}
+	return strings.TrimSpace(string(logs))
+}
+
+// warningEvents prints the warning events of the pods that were not printed before. The events
+// of the whole namespace are listed at once instead of once per pod
+func warningEvents(ctx context.Context, clientset *kubernetes.Clientset, namespace string, pods []corev1.Pod, since time.Time, seen map[string]int32) error {
+	names := make(map[string]bool, len(pods))
+	for _, pod := range pods {
+		names[pod.Name] = true
+	}
+
+	events, err := clientset.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.AndSelectors(
+			fields.OneTermEqualSelector("involvedObject.kind", "Pod"),
+			fields.OneTermEqualSelector("type", corev1.EventTypeWarning),
+		).String(),
+	})
+	if err != nil {
+		return err
+	}
+	for _, event := range events.Items {
+		if !names[event.InvolvedObject.Name] {
+			continue
+		}
+		if event.LastTimestamp.Time.Before(since) && event.EventTime.Time.Before(since) && (event.Series == nil || event.Series.LastObservedTime.Time.Before(since)) {
+			continue
+		}
+		// events of events.k8s.io (e.g. FailedScheduling) have no count, repetitions are counted in the series
+		count := event.Count
+		if event.Series != nil {
+			count = event.Series.Count
+		}
+		if last, ok := seen[string(event.UID)]; ok && last == count {
+			continue
+		}
+		seen[string(event.UID)] = count
+		log.Printf("%s: %s %s\n", event.InvolvedObject.Name, event.Reason, event.Message)
+	}
+	return nil
+}
+
+// statefulSetReady reports if all replicas of the stateful set are updated and available
+func statefulSetReady(sts *appsv1.StatefulSet, replicas int32) bool {
+	return sts.Status.ObservedGeneration >= sts.Generation && sts.Status.AvailableReplicas == replicas && sts.Status.UpdatedReplicas == expectedUpdatedReplicas(sts, replicas)
+}
+
+// checkStatefulSet is a single iteration of waitForStatefulSet, it reports if the stateful set
+// is ready and fails if a pod is in a state it will not recover from
+func checkStatefulSet(ctx context.Context, clientset *kubernetes.Clientset, options stateFullSetOptions) (bool, error) {
+	sts, err := clientset.AppsV1().StatefulSets(options.Namespace).Get(ctx, options.Name(), metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+	if statefulSetReady(sts, options.Replicas) {
+		return true, nil
+	}
+
+	pods, err := clientset.CoreV1().Pods(options.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(options.podLabels()).String(),
+	})
+	if err != nil {
+		return false, err
+	}
+	for _, pod := range pods.Items {
+		failure := checkPod(pod, time.Now())
+		if failure != nil && failure.Fatal {
+			return false, fmt.Errorf("%s did not start: %s", options.Name(), failure)
+		}
+	}
+	return false, nil
+}
+
+// checkRole reports if all stateful sets of the role are ready, see checkStatefulSet
+func checkRole(ctx context.Context, clientset *kubernetes.Clientset, options stateFullSetOptions) (bool, error) {
+	ready := true
+	for _, set := range options.statefulSets() {
+		setReady, err := checkStatefulSet(ctx, clientset, set)
+		if err != nil {
+			return false, err
+		}
+		ready = ready && setReady
+	}
+	return ready, nil
+}
+
+// waitForRole blocks until all stateful sets of the role are ready, see waitForStatefulSet
+func waitForRole(ctx context.Context, clientset *kubernetes.Clientset, options stateFullSetOptions) error {
+	for _, set := range options.statefulSets() {
+		err := waitForStatefulSet(ctx, clientset, set)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitForStatefulSet blocks until all replicas of the stateful set are updated and available.
+// It watches the pods and their events in the meantime, reports why pods do not start and
+// fails fast if a pod is in a state it will not recover from
+func waitForStatefulSet(ctx context.Context, clientset *kubernetes.Clientset, options stateFullSetOptions) error {
+	stsClient := clientset.AppsV1().StatefulSets(options.Namespace)
+	podClient := clientset.CoreV1().Pods(options.Namespace)
+	selector := labels.SelectorFromSet(options.podLabels()).String()
+
+	start := time.Now()
+	seenEvents := map[string]int32{}
+	reported := map[string]string{}
+	var sts *appsv1.StatefulSet
+
+	for {
+		var err error
+		sts, err = stsClient.Get(ctx, options.Name(), metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if statefulSetReady(sts, options.Replicas) {
+			return nil
+		}
+
+		log.Printf("waiting for %s to reach desired state [%d/%d]\n", options.Name(), sts.Status.AvailableReplicas, options.Replicas)
+
+		pods, err := podClient.List(ctx, metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return err
+		}
+
+		for _, pod := range pods.Items {
+			failure := checkPod(pod, time.Now())
+			if failure == nil {
+				delete(reported, pod.Name)
+				continue
+			}
+
+			if failure.Fatal {
+				err := fmt.Errorf("%s did not start: %s", options.Name(), failure)
+				if logs := containerLogTail(ctx, clientset, options.Namespace, *failure); logs != "" {
+					err = fmt.Errorf("%w\nlast log lines of %s:\n%s", err, failure.Pod, logs)
+				}
+				return err
+			}
+
+			if reported[pod.Name] != failure.String() {
+				reported[pod.Name] = failure.String()
+				log.Println(failure)
+			}
+		}
+
+		err = warningEvents(ctx, clientset, options.Namespace, pods.Items, start, seenEvents)
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s did not reach desired state [%d/%d]: %w", options.Name(), sts.Status.AvailableReplicas, options.Replicas, ctx.Err())
+		case <-time.After(DEFAULT_TIMEOUT):
+		}
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"github.com/ava-labs/avalanchego/network/peer"
 	"github.com/ava-labs/avalanchego/staking"
 	"github.com/ava-labs/avalanchego/utils/cb58"
+	"github.com/ava-labs/avalanchego/utils/constants"
 	"github.com/ava-labs/avalanchego/utils/crypto"
 	"github.com/ava-labs/avalanchego/utils/formatting/address"
 	"github.com/ethereum/go-ethereum/common"
@@ -29,6 +30,28 @@ import (
 const BOND_AMOUNT = uint64(1e15)
 const DOCKER_COMPOSE_LOCAL_NETWORK_ID = 54321
 
+// DEFAULT_NETWORK_ID is the id of kopernikus, the network the k8s test networks pose as
+const DEFAULT_NETWORK_ID = 1002
+
+// ParseNetworkID accepts everything camino-node accepts as --network-id: a number,
+// network-<number> or the name of a known network like kopernikus
+func ParseNetworkID(s string) (uint32, error) {
+	id, err := constants.NetworkID(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid network id '%s': %w", s, err)
+	}
+	if id == 0 {
+		return 0, fmt.Errorf("invalid network id '%s': must not be 0", s)
+	}
+	return id, nil
+}
+
+// NetworkIDName is the name camino-node uses for a network id, it names the directory of the
+// database and is accepted as --network-id
+func NetworkIDName(id uint32) string {
+	return constants.NetworkName(id)
+}
+
 func createAllocations(stakers []Staker, config NetworkConfig) []genesis.UnparsedAllocation {
 
 	allocations := make([]genesis.UnparsedAllocation, 0)
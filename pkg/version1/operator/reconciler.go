@@ -0,0 +1,451 @@
+/*
+ * reconciler.go
+ * Copyright (C) 2022, Chain4Travel AG. All rights reserved.
+ * See the file LICENSE for licensing terms.
+ */
+
+// Package operator reconciles CaminoNetwork resources with the same functions 'camktncr k8s create' uses
+package operator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"chain4travel.com/camktncr/pkg/version1"
+	"chain4travel.com/camktncr/pkg/version1/api/v1alpha1"
+	"chain4travel.com/camktncr/pkg/version1/k8s"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+const FINALIZER = "camino.chain4travel.com/cleanup"
+
+// NETWORK_SECRET_KEY is the key of the generated network in the secret referenced by the spec
+const NETWORK_SECRET_KEY = "network.json"
+
+// FAILED_REQUEUE_AFTER is the time after which a failed network is reconciled again
+const FAILED_REQUEUE_AFTER = time.Minute
+
+// PROVISION_REQUEUE_AFTER is the time after which the nodes of a provisioning network are checked again
+const PROVISION_REQUEUE_AFTER = 30 * time.Second
+
+// LOCKED_REQUEUE_AFTER is the time after which a network that is locked by a command is reconciled again
+const LOCKED_REQUEUE_AFTER = 30 * time.Second
+
+type Reconciler struct {
+	client.Client
+	RestConfig *rest.Config
+	Clientset  *kubernetes.Clientset
+}
+
+func (r *Reconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// status updates do not trigger reconciles, the requeues drive the provisioning
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&v1alpha1.CaminoNetwork{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(r)
+}
+
+// k8sConfig maps the spec onto the configuration create builds from its flags, the
+// network is named after the resource and lives in the namespace of the resource
+func k8sConfig(network *v1alpha1.CaminoNetwork, caps k8s.ClusterCapabilities) version1.K8sConfig {
+	storage := version1.K8sStorage{
+		Size:       resource.MustParse("10Gi"),
+		AccessMode: corev1.ReadWriteOnce,
+	}
+	archiveStorage := version1.K8sStorage{
+		Size:       resource.MustParse("100Gi"),
+		AccessMode: corev1.ReadWriteOnce,
+	}
+
+	monitoring := network.Spec.Monitoring
+
+	policies := network.Spec.NetworkPolicies
+	ingressNamespaces := policies.IngressNamespaces
+	if len(ingressNamespaces) == 0 {
+		ingressNamespaces = []string{"ingress-nginx"}
+	}
+	monitoringNamespaces := policies.MonitoringNamespaces
+	if len(monitoringNamespaces) == 0 {
+		monitoringNamespaces = []string{"monitoring"}
+	}
+
+	return version1.K8sConfig{
+		K8sPrefix: network.Name,
+		Namespace: network.Namespace,
+		Labels: map[string]string{
+			"network": network.Name,
+		},
+		Image:          network.Spec.Image,
+		ImageOverrides: network.Spec.ImageOverrides,
+		Domain:         network.Spec.Ingress.Domain,
+		TLSSecretName:  network.Spec.Ingress.TLSSecretName,
+		PullSecretName: network.Spec.PullSecretName,
+		Resources: version1.K8sResources{
+			Api:       network.Spec.Resources.Api,
+			Validator: network.Spec.Resources.Validator,
+			Archive:   network.Spec.Resources.Archive,
+		},
+		Storage: version1.K8sStorages{
+			Api:       storage,
+			Validator: storage,
+			Archive:   archiveStorage,
+		},
+		NodeConfigs: version1.K8sNodeConfigs{
+			Api: version1.K8sNodeConfig{
+				Flags:        network.Spec.NodeConfig.Api.Flags,
+				ChainConfigs: network.Spec.NodeConfig.Api.ChainConfigs,
+			},
+			Validator: version1.K8sNodeConfig{
+				Flags:        network.Spec.NodeConfig.Validator.Flags,
+				ChainConfigs: network.Spec.NodeConfig.Validator.ChainConfigs,
+			},
+			Archive: version1.K8sNodeConfig{
+				Flags:        network.Spec.NodeConfig.Archive.Flags,
+				ChainConfigs: network.Spec.NodeConfig.Archive.ChainConfigs,
+			},
+		},
+		Probes: version1.K8sProbes{
+			Api:       version1.K8sProbe{StartupTimeout: 60 * time.Minute, LivenessTimeout: 2 * time.Minute},
+			Validator: version1.K8sProbe{StartupTimeout: 30 * time.Minute, LivenessTimeout: 2 * time.Minute},
+			Archive:   version1.K8sProbe{StartupTimeout: 120 * time.Minute, LivenessTimeout: 2 * time.Minute},
+		},
+		NetworkPolicies: version1.K8sNetworkPolicies{
+			Enabled:              !policies.Disabled,
+			IngressNamespaces:    ingressNamespaces,
+			MonitoringNamespaces: monitoringNamespaces,
+			Allow:                policies.Allow,
+		},
+		EnableMonitoring:  monitoring.Enabled,
+		ScrapeAnnotations: monitoring.Enabled && !caps.ServiceMonitors,
+		EnableDashboards:  monitoring.Dashboards,
+		DashboardLabel:    k8s.DEFAULT_DASHBOARD_LABEL,
+		EnableAlerts:      monitoring.Alerts && caps.PrometheusRules,
+		NodeRoutes:        network.Spec.Ingress.NodeRoutes,
+		P2PExposure:       version1.P2P_EXPOSURE_NONE,
+		ArchiveIngress:    network.Spec.Ingress.Archive && network.Spec.ArchiveNodes > 0,
+	}
+}
+
+func (r *Reconciler) loadNetwork(ctx context.Context, network *v1alpha1.CaminoNetwork) (*version1.Network, error) {
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, client.ObjectKey{Namespace: network.Namespace, Name: network.Spec.NetworkSecret}, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	data, ok := secret.Data[NETWORK_SECRET_KEY]
+	if !ok {
+		return nil, fmt.Errorf("secret %s does not contain %s", network.Spec.NetworkSecret, NETWORK_SECRET_KEY)
+	}
+
+	var out version1.Network
+	err = json.Unmarshal(data, &out)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse %s of secret %s: %w", NETWORK_SECRET_KEY, network.Spec.NetworkSecret, err)
+	}
+	return &out, nil
+}
+
+// setStatus writes the status of the resource, the phase is logged so the operator output follows the progress
+func (r *Reconciler) setStatus(ctx context.Context, network *v1alpha1.CaminoNetwork, phase string, message string) error {
+	if network.Status.Phase != phase {
+		log.Printf("%s/%s: %s\n", network.Namespace, network.Name, phase)
+	}
+	network.Status.Phase = phase
+	network.Status.Message = message
+	return r.Status().Update(ctx, network)
+}
+
+func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	network := &v1alpha1.CaminoNetwork{}
+	err := r.Get(ctx, req.NamespacedName, network)
+	if k8sErrors.IsNotFound(err) {
+		return ctrl.Result{}, nil
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	caps, err := k8s.DiscoverCapabilities(r.RestConfig)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	config := k8sConfig(network, caps)
+
+	// a network that is ready for the observed generation is left alone without taking its lock
+	if network.DeletionTimestamp.IsZero() && network.Status.Phase == v1alpha1.PHASE_READY && network.Status.ObservedGeneration == network.Generation {
+		return ctrl.Result{}, nil
+	}
+
+	// the operator and camktncr commands must not change the network at the same time
+	ctx, unlock, err := lockNetwork(ctx, r.Clientset, config)
+	if errors.Is(err, k8s.ErrNetworkLocked) {
+		log.Printf("%s/%s: %v\n", network.Namespace, network.Name, err)
+		return ctrl.Result{RequeueAfter: LOCKED_REQUEUE_AFTER}, nil
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	defer unlock()
+
+	if !network.DeletionTimestamp.IsZero() {
+		if !controllerutil.ContainsFinalizer(network, FINALIZER) {
+			return ctrl.Result{}, nil
+		}
+
+		err = r.setStatus(ctx, network, v1alpha1.PHASE_DELETING, "")
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+
+		err = k8s.DeleteCluster(ctx, r.RestConfig, r.Clientset, config, false)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+
+		controllerutil.RemoveFinalizer(network, FINALIZER)
+		return ctrl.Result{}, r.Update(ctx, network)
+	}
+
+	if !controllerutil.ContainsFinalizer(network, FINALIZER) {
+		controllerutil.AddFinalizer(network, FINALIZER)
+		err = r.Update(ctx, network)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	result, err := r.reconcileNetwork(ctx, network, config)
+	if err != nil {
+		log.Printf("%s/%s: %v\n", network.Namespace, network.Name, err)
+		statusErr := r.setStatus(ctx, network, v1alpha1.PHASE_FAILED, err.Error())
+		if statusErr != nil {
+			return ctrl.Result{}, statusErr
+		}
+		return ctrl.Result{RequeueAfter: FAILED_REQUEUE_AFTER}, nil
+	}
+
+	return result, nil
+}
+
+// lockNetwork takes the lease of the network like the mutating commands do, the returned context
+// is canceled when the lease is lost and the returned function releases it
+func lockNetwork(ctx context.Context, clientset *kubernetes.Clientset, config version1.K8sConfig) (context.Context, func(), error) {
+	lock, err := k8s.AcquireNetworkLock(ctx, clientset, config, "operator")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-lock.Lost():
+			log.Printf("%s: lost the lock of the network: %v\n", config.K8sPrefix, lock.Err())
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		cancel()
+		err := lock.Release(context.Background())
+		if err != nil {
+			log.Printf("%s: could not release lock: %v\n", config.K8sPrefix, err)
+		}
+	}, nil
+}
+
+// reconcileNetwork never blocks until the nodes are up, it provisions the network and requeues
+// until all nodes are ready, then registers the validators one per reconcile
+func (r *Reconciler) reconcileNetwork(ctx context.Context, network *v1alpha1.CaminoNetwork, config version1.K8sConfig) (ctrl.Result, error) {
+	if network.Status.Phase == "" {
+		err := r.setStatus(ctx, network, v1alpha1.PHASE_PENDING, "")
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	generated, err := r.loadNetwork(ctx, network)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	numValidators := int(network.Spec.Validators)
+	numInitialStakers := len(generated.GenesisConfig.InitialStakers)
+	if numValidators < numInitialStakers {
+		return ctrl.Result{}, fmt.Errorf("network needs at least all initial stakers to be started: %d < %d", numValidators, numInitialStakers)
+	}
+	if numValidators > len(generated.Stakers) {
+		return ctrl.Result{}, fmt.Errorf("network secret '%s' does not contain enough validators: %d > %d", network.Spec.NetworkSecret, numValidators, len(generated.Stakers))
+	}
+
+	if generated.GenesisConfig.NetworkID == 0 {
+		return ctrl.Result{}, fmt.Errorf("network secret '%s' has no network id, please regenerate", network.Spec.NetworkSecret)
+	}
+	config.NetworkID = generated.GenesisConfig.NetworkID
+
+	// the nodes of the observed generation are ready once the registration started
+	if network.Status.Phase != v1alpha1.PHASE_REGISTERING || network.Status.ObservedGeneration != network.Generation {
+		waitingFor, err := r.provision(ctx, network, config, generated)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if waitingFor != "" {
+			err = r.setStatus(ctx, network, v1alpha1.PHASE_PROVISIONING, fmt.Sprintf("waiting for %s nodes", waitingFor))
+			return ctrl.Result{RequeueAfter: PROVISION_REQUEUE_AFTER}, err
+		}
+
+		network.Status.ObservedGeneration = network.Generation
+		network.Status.ValidatorsToRegister = int32(numValidators - numInitialStakers)
+		if network.Status.RegisteredValidators > network.Status.ValidatorsToRegister {
+			network.Status.RegisteredValidators = 0
+		}
+		err = r.setStatus(ctx, network, v1alpha1.PHASE_REGISTERING, "")
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// validators are registered one per reconcile so the status shows the progress
+	toRegister := generated.Stakers[numInitialStakers:numValidators]
+	if i := network.Status.RegisteredValidators; i < int32(len(toRegister)) {
+		_, err = k8s.RegisterValidators(ctx, r.RestConfig, config, toRegister[i:i+1], true)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		network.Status.RegisteredValidators = i + 1
+		err = r.setStatus(ctx, network, v1alpha1.PHASE_REGISTERING, fmt.Sprintf("registered %s", toRegister[i].NodeID))
+		return ctrl.Result{Requeue: true}, err
+	}
+
+	nodes, err := k8s.ListNodes(ctx, r.Clientset, config)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	network.Status.NodeImages = make(map[string]string, len(nodes))
+	for _, n := range nodes {
+		network.Status.NodeImages[n.Name()] = n.Image
+	}
+
+	return ctrl.Result{}, r.setStatus(ctx, network, v1alpha1.PHASE_READY, "")
+}
+
+// provision runs the steps of create without waiting for the nodes, every step is safe to rerun on
+// an existing network. It returns the role of the first nodes that are not ready, later roles are only
+// applied once the nodes before them are ready
+func (r *Reconciler) provision(ctx context.Context, network *v1alpha1.CaminoNetwork, config version1.K8sConfig, generated *version1.Network) (string, error) {
+	numValidators := int(network.Spec.Validators)
+
+	k := r.Clientset
+	if config.NetworkPolicies.Enabled {
+		err := k8s.CreateNetworkPolicies(ctx, k, config)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	for _, secretName := range []string{config.PullSecretName, config.TLSSecretName} {
+		if secretName == "" {
+			continue
+		}
+		err := k8s.CopySecretFromDefaultNamespace(ctx, k, config, secretName)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// the genesis must not change once the network is running
+	existing, err := k8s.GetNetworkGenesis(ctx, k, config)
+	if k8sErrors.IsNotFound(err) {
+		now := time.Now().Unix()
+		built := version1.BuildGenesisConfig(generated.GenesisConfig.Allocations, uint64(now), generated.Stakers[:numValidators], network.Name, uint64(generated.GenesisConfig.NetworkID))
+		err = k8s.CreateNetworkConfigMap(ctx, k, built, config)
+	} else if err == nil && existing.NetworkID != config.NetworkID {
+		err = fmt.Errorf("network id %d of the running genesis does not match %d of the network secret", existing.NetworkID, config.NetworkID)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	err = k8s.CreateScriptsConfigMap(ctx, k, config)
+	if err != nil {
+		return "", err
+	}
+	err = k8s.CreateNodeConfigMap(ctx, k, config)
+	if err != nil {
+		return "", err
+	}
+	err = k8s.CreateStakerSecrets(ctx, r.RestConfig, k, k8s.NewKubernetesSecretProvider(k, config), generated.Stakers, config)
+	if err != nil {
+		return "", err
+	}
+
+	roles := []struct {
+		role     string
+		replicas int32
+	}{
+		{"root", 1},
+		{"validator", int32(numValidators) - 1},
+		{"api", network.Spec.ApiNodes},
+		{"archive", network.Spec.ArchiveNodes},
+	}
+	for _, role := range roles {
+		if role.role == "archive" && role.replicas == 0 {
+			continue
+		}
+		ready, err := k8s.ApplyNodes(ctx, r.RestConfig, k, config, role.role, role.replicas)
+		if err != nil {
+			return "", err
+		}
+		if !ready {
+			return role.role, nil
+		}
+	}
+
+	endpoints := map[string]string{}
+	if config.Domain != "" {
+		err = k8s.CreateIngress(ctx, k, config, network.Spec.Ingress.Annotations)
+		if err != nil {
+			return "", err
+		}
+		if config.NodeRoutes {
+			err = k8s.CreateNodeIngress(ctx, k, config, generated.Stakers[:numValidators], network.Spec.ApiNodes, network.Spec.ArchiveNodes, network.Spec.Ingress.Annotations)
+			if err != nil {
+				return "", err
+			}
+		}
+		endpoints["api"] = k8s.IngressURL(config, "/")
+		endpoints["static"] = k8s.IngressURL(config, "/static")
+		if config.ArchiveIngress {
+			endpoints["archive"] = k8s.IngressURL(config, "/archive")
+		}
+	}
+
+	if config.EnableDashboards {
+		err = k8s.CreateDashboards(ctx, k, config)
+		if err != nil {
+			return "", err
+		}
+	}
+	if config.EnableAlerts {
+		err = k8s.CreateAlertRules(ctx, r.RestConfig, config)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	network.Status.Endpoints = endpoints
+	return "", nil
+}
@@ -8,11 +8,14 @@ package version1
 
 import (
 	"crypto/tls"
+	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/ava-labs/avalanchego/genesis"
 	"github.com/ava-labs/avalanchego/ids"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -35,27 +38,178 @@ type NetworkConfig struct {
 	DefaultStake      uint64
 }
 
+const (
+	P2P_EXPOSURE_NONE         = "none"
+	P2P_EXPOSURE_LOADBALANCER = "loadbalancer"
+	P2P_EXPOSURE_NODEPORT     = "nodeport"
+)
+
 type K8sResources struct {
-	Api       corev1.ResourceList
-	Validator corev1.ResourceList
+	Api                 corev1.ResourceList
+	Validator           corev1.ResourceList
+	Archive             corev1.ResourceList
+	ApiLimits           corev1.ResourceList
+	ValidatorLimits     corev1.ResourceList
+	ArchiveLimits       corev1.ResourceList
+	ApiScheduling       K8sScheduling
+	ValidatorScheduling K8sScheduling
+	ArchiveScheduling   K8sScheduling
+}
+
+const (
+	SPREAD_NONE      = "none"
+	SPREAD_PREFERRED = "preferred"
+	SPREAD_REQUIRED  = "required"
+)
+
+// K8sScheduling describes where the pods of a role are placed. NodeSpread and ZoneSpread
+// generate anti affinity and topology spread constraints, everything else is passed to the pod spec as is
+type K8sScheduling struct {
+	NodeSelector              map[string]string                 `json:"nodeSelector,omitempty"`
+	Tolerations               []corev1.Toleration               `json:"tolerations,omitempty"`
+	Affinity                  *corev1.Affinity                  `json:"affinity,omitempty"`
+	TopologySpreadConstraints []corev1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+	NodeSpread                string                            `json:"nodeSpread,omitempty"`
+	ZoneSpread                string                            `json:"zoneSpread,omitempty"`
+}
+
+type K8sProbe struct {
+	// StartupTimeout is the time a node gets to bootstrap before it is restarted
+	StartupTimeout time.Duration
+	// LivenessTimeout is the time a node may stop answering before it is restarted
+	LivenessTimeout time.Duration
+}
+
+type K8sProbes struct {
+	Api       K8sProbe
+	Validator K8sProbe
+	Archive   K8sProbe
+	Disabled  bool
+}
+
+type K8sNetworkPolicies struct {
+	Enabled              bool
+	IngressNamespaces    []string
+	MonitoringNamespaces []string
+	// Allow contains CIDRs or namespace names that may access the http api
+	Allow []string
+}
+
+// K8sNodeConfig is rendered into the config file and chain configs of the nodes of a role
+type K8sNodeConfig struct {
+	// Flags are camino-node flags without the leading --, they replace the defaults of the role
+	Flags map[string]string
+	// ChainConfigs maps chain aliases, e.g. C, to the content of their config.json
+	ChainConfigs map[string]string
+}
+
+type K8sNodeConfigs struct {
+	Api       K8sNodeConfig
+	Validator K8sNodeConfig
+	// Archive runs with a C-chain config without pruning unless it contains another one for C
+	Archive K8sNodeConfig
+}
+
+type K8sStorage struct {
+	StorageClass string
+	Size         resource.Quantity
+	AccessMode   corev1.PersistentVolumeAccessMode
+}
+
+type K8sStorages struct {
+	Api       K8sStorage
+	Validator K8sStorage
+	Archive   K8sStorage
+	// Ephemeral keeps the node data in an emptyDir, it is lost with the pod
+	Ephemeral bool
+}
+
+// K8sImageOverride runs the nodes of a role with the ordinals From to To with another image than
+// K8sConfig.Image, To is -1 for all ordinals from From on. Overrides are applied in order,
+// the last override covering a node wins
+type K8sImageOverride struct {
+	Role  string `json:"role"`
+	From  int32  `json:"from"`
+	To    int32  `json:"to"`
+	Image string `json:"image"`
+}
+
+// Covers reports if the override applies to the node of role with the given ordinal
+func (o K8sImageOverride) Covers(role string, ordinal int32) bool {
+	return o.Role == role && ordinal >= o.From && (o.To < 0 || ordinal <= o.To)
+}
+
+const (
+	EXTERNAL_SECRET_STORE         = "SecretStore"
+	EXTERNAL_CLUSTER_SECRET_STORE = "ClusterSecretStore"
+)
+
+// K8sStakerSecrets describes how the certificates and keys of the stakers get into the namespace.
+// Without an ExternalSecretStore they are written as secrets, otherwise the external secrets
+// operator syncs them from Path/<secret name> of the store
+type K8sStakerSecrets struct {
+	ExternalSecretStore     string
+	ExternalSecretStoreKind string
+	Path                    string
+	// ExcludePrivateKeys keeps the funded private keys of the stakers out of the cluster
+	ExcludePrivateKeys bool
 }
 
 type K8sConfig struct {
 	K8sPrefix        string
 	Namespace        string
+	NetworkID        uint32
 	Domain           string
 	Labels           map[string]string
 	Image            string
+	ImageOverrides   []K8sImageOverride
 	TLSSecretName    string
 	PullSecretName   string
 	Resources        K8sResources
+	Storage          K8sStorages
+	Probes           K8sProbes
+	NodeConfigs      K8sNodeConfigs
+	NetworkPolicies  K8sNetworkPolicies
 	EnableMonitoring bool
+	// ScrapeAnnotations replaces the service monitors with prometheus.io/scrape pod annotations
+	// on clusters without the prometheus operator
+	ScrapeAnnotations bool
+	EnableDashboards  bool
+	// DashboardLabel is the key=value the grafana sidecar discovers dashboard config maps with
+	DashboardLabel  string
+	EnableAlerts    bool
+	NodeRoutes      bool
+	NodeRoutesAdmin bool
+	P2PExposure     string
+	P2PPublicIP     string
+	P2PNodePortBase int32
+	// ArchiveIngress publishes the archive nodes under /archive
+	ArchiveIngress bool
+	// ArchiveTxLookupLimit is the number of recent blocks the archive nodes index transactions
+	// of, 0 indexes all blocks
+	ArchiveTxLookupLimit uint64
+	StakerSecrets        K8sStakerSecrets
 }
 
 func (k K8sConfig) PrefixWith(s string) string {
 	return fmt.Sprintf("%s-%s", k.K8sPrefix, s)
 }
 
+// NodeImage is the image the node of role with the given ordinal runs with
+func (k K8sConfig) NodeImage(role string, ordinal int32) string {
+	image := k.Image
+	for _, o := range k.ImageOverrides {
+		if o.Covers(role, ordinal) {
+			image = o.Image
+		}
+	}
+	return image
+}
+
+func (k K8sConfig) ExposesP2P() bool {
+	return k.P2PExposure != "" && k.P2PExposure != P2P_EXPOSURE_NONE
+}
+
 func (k K8sConfig) Selector() *metav1.LabelSelector {
 
 	sel := &metav1.LabelSelector{}
@@ -90,19 +244,43 @@ type Network struct {
 	Stakers       []Staker
 }
 
+// NodeConfig is the config file of camino-node, flags given on the command line take precedence
 type NodeConfig struct {
-	DataDir         string `json:"data-dir"`
-	HttpPort        uint64 `json:"http-port"`
-	StakingPort     uint64 `json:"staking-port"`
-	HttpHost        string `json:"http-host"`
-	PublicIp        string `json:"public-ip"`
-	IndexEnabled    bool   `json:"index-enabled"`
-	ApiAdminEnabled bool   `json:"api-admin-enabled"`
-	LogDisplayLevel string `json:"log-display-level"`
-	LogLevel        string `json:"log-level"`
-	NetworkID       uint64 `json:"network-id"`
-	BootstrapIPs    string `json:"bootstrap-ips"`
-	BootstrapIDs    string `json:"bootstrap-ids"`
+	DataDir            string `json:"data-dir,omitempty"`
+	DBDir              string `json:"db-dir,omitempty"`
+	GenesisFile        string `json:"genesis,omitempty"`
+	HttpPort           uint64 `json:"http-port,omitempty"`
+	StakingPort        uint64 `json:"staking-port,omitempty"`
+	HttpHost           string `json:"http-host,omitempty"`
+	HttpAllowedOrigins string `json:"http-allowed-origins,omitempty"`
+	PublicIp           string `json:"public-ip,omitempty"`
+	IndexEnabled       bool   `json:"index-enabled,omitempty"`
+	ApiAdminEnabled    bool   `json:"api-admin-enabled,omitempty"`
+	LogDisplayLevel    string `json:"log-display-level,omitempty"`
+	LogLevel           string `json:"log-level,omitempty"`
+	NetworkID          uint64 `json:"network-id,omitempty"`
+	// nil leaves the bootstrap nodes to the flags, the root node of a network gets empty ones
+	BootstrapIPs *string `json:"bootstrap-ips,omitempty"`
+	BootstrapIDs *string `json:"bootstrap-ids,omitempty"`
+}
+
+// Render returns the config file with the extra flags added, extra flags replace the fields of the config
+func (c NodeConfig) Render(extra map[string]string) ([]byte, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	config := map[string]interface{}{}
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range extra {
+		config[k] = v
+	}
+
+	return json.MarshalIndent(config, "", "\t")
 }
 
 type CChainConfig struct {
@@ -110,4 +288,5 @@ type CChainConfig struct {
 	AllowMissingTries           bool   `json:"allow-missing-tries"`
 	OfflinePruningEnabled       bool   `json:"offline-pruning-enabled"`
 	OfflinePruningDataDirectory string `json:"offline-pruning-data-directory"`
+	TxLookupLimit               uint64 `json:"tx-lookup-limit,omitempty"`
 }